@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2022 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package c2go
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/weblfe/c2go/cl"
+	ctypes "github.com/weblfe/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// Target is where Build writes generated Go files to.
+type Target interface {
+	WriteFile(name string, data []byte) error
+}
+
+type osTarget struct{}
+
+func (osTarget) WriteFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0666)
+}
+
+type memTarget struct{}
+
+func (memTarget) WriteFile(name string, data []byte) error {
+	return nil
+}
+
+var (
+	// OSTarget writes generated Go files to the file system. It's the default.
+	OSTarget Target = osTarget{}
+
+	// InMemory doesn't write generated Go files anywhere. They are only
+	// returned in Result.Files.
+	//
+	// Note that it doesn't make the build read-only: intermediate files are
+	// still written next to C files (or in OutDir), ie. preprocessed *.i files,
+	// c2go.a.pub of c2go projects, *.json if DumpJson and temporary *.layout.i
+	// if LayoutTest. And the build cache is still updated (see C2GO_CACHE).
+	// Set OutDir to a temporary directory to keep the source tree untouched.
+	InMemory Target = memTarget{}
+)
+
+// Options specifies how Build translates C files into Go.
+type Options struct {
+	// Input specifies what to translate: a *.c or *.i file, a directory of C
+	// files, a c2go project directory (where there is a c2go.cfg file), or a
+	// pattern "dir/..." which means all of them under dir.
+	Input string
+
+	// PkgName specifies name of the Go package. Default is "main".
+	PkgName string
+
+	// Select specifies to translate only one file of a project.
+	Select string
+
+	// Jobs specifies how many packages (or C files of a project) can be
+	// processed in parallel. It means 1 if Jobs <= 0.
+	Jobs int
+
+	// OutDir specifies a directory to put all intermediate and generated files
+	// in, which mirrors layout of the source tree. If empty, files are put next
+	// to C files (or in directories that c2go.cfg specifies).
+	OutDir string
+
+	// Triple specifies the target which C files are compiled for, eg.
+	// "aarch64-linux-gnu" or "wasm32". Default is the host.
+	Triple string
+
+	RunApp          bool // run the translated Go program
+	RunTest         bool // run and compare outputs of the translated Go program and the C one
+	TestMain        bool // generate TestMain func as entry, not main func
+	FailFast        bool // stop at the first failure of "dir/..."
+	DepsAutoGen     bool // write dependencies to c2go_autogen.go
+	ForcePreprocess bool // always run preprocessor, ignoring the build cache
+	DumpJson        bool // dump C AST to *.json files
+	KeepGoing       bool // stub out functions which can't be translated
+	ArchNeutral     bool // generate Go code which works on all platforms, see cl.Config
+	LayoutTest      bool // write c2go_layout_test.go which checks layouts of structs and unions
+
+	// Stdout and Stderr specify where progress and outputs of commands go.
+	// They are discarded if nil.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Target specifies where generated Go files are written to. If nil, it's
+	// OSTarget. Note that RunApp, RunTest and installing Go packages of c2go
+	// projects require OSTarget. Intermediate files (*.i, etc.) are always
+	// written to the file system (see OutDir).
+	Target Target
+}
+
+func (p *Options) flags() (flags int) {
+	for _, v := range []struct {
+		on   bool
+		flag int
+	}{
+		{p.RunApp, FlagRunApp},
+		{p.RunTest, FlagRunTest},
+		{p.TestMain, FlagTestMain},
+		{p.FailFast, FlagFailFast},
+		{p.DepsAutoGen, FlagDepsAutoGen},
+		{p.ForcePreprocess, FlagForcePreprocess},
+		{p.DumpJson, FlagDumpJson},
+		{p.KeepGoing, FlagKeepGoing},
+		{p.ArchNeutral, FlagArchNeutral},
+		{p.LayoutTest, FlagLayoutTest},
+	} {
+		if v.on {
+			flags |= v.flag
+		}
+	}
+	return
+}
+
+// Result is the result of Build.
+type Result struct {
+	// Files are all generated Go files, keyed by file path.
+	Files map[string][]byte
+
+	// Diags are diagnostics of functions which are stubbed out in keep-going
+	// mode.
+	Diags cl.ErrorList
+}
+
+var (
+	ErrNeedOSTarget = errors.New("c2go: RunApp and RunTest require OSTarget")
+)
+
+// Build translates C files specified by opts.Input into Go. If translation
+// fails, err is a cl.ErrorList which describes the failures. Other errors are
+// returned as they are, eg. *parser.ParseError if clang fails to dump AST,
+// or ctx.Err() if ctx is canceled.
+func Build(ctx context.Context, opts Options) (*Result, error) {
+	target := opts.Target
+	if target == nil {
+		target = OSTarget
+	}
+	if (opts.RunApp || opts.RunTest) && target != OSTarget {
+		return nil, ErrNeedOSTarget
+	}
+	pkgname := opts.PkgName
+	if pkgname == "" {
+		pkgname = "main"
+	}
+	conf := &Config{Select: opts.Select, Jobs: opts.Jobs, OutDir: opts.OutDir, Triple: opts.Triple}
+	out := newOutput(ctx, opts.Stdout, opts.Stderr, target)
+	return build(pkgname, opts.Input, opts.flags(), conf, out)
+}
+
+func build(pkgname, infile string, flags int, conf *Config, out *output) (ret *Result, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = newError(e)
+		}
+	}()
+	out.arch, err = ctypes.ParseTarget(conf.triple())
+	check(err)
+	run(pkgname, infile, flags, conf, out)
+	return &Result{Files: out.res.files, Diags: out.res.diags}, nil
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,72 @@
+package c2go
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/weblfe/c2go/cl"
+)
+
+// -----------------------------------------------------------------------------
+
+// testAST is AST of `void f(void) { ... }`, where ... is an expression which
+// cl doesn't support.
+const testAST = `{"kind": "TranslationUnitDecl", "inner": [{
+	"kind": "FunctionDecl", "name": "f", "type": {"qualType": "void (void)"},
+	"loc": {"offset": 5, "line": 1, "col": 6, "tokLen": 1},
+	"range": {"begin": {"offset": 0, "col": 1, "tokLen": 4}, "end": {"offset": 20, "col": 21, "tokLen": 1}},
+	"inner": [{"kind": "CompoundStmt", "inner": [{"kind": "UnknownExpr", "type": {"qualType": "int"}}]}]
+}]}`
+
+// TestBuildInMemory builds a C file whose AST is in the cache, so it doesn't
+// need clang.
+func TestBuildInMemory(t *testing.T) {
+	dir := t.TempDir()
+	old := theCache
+	theCache = &buildCache{dir: filepath.Join(dir, "cache")}
+	defer func() { theCache = old }()
+
+	infile := filepath.Join(dir, "foo.c")
+	writeTestFiles(t, "", map[string]string{infile: "void f(void) { ... }\n"})
+	out := newOutput(context.Background(), nil, nil, InMemory)
+	srckey := srcKey(infile, out.ppConfig(), out.arch.Flags())
+	storeTestTU(t, theCache, srckey, infile, []byte(testAST))
+
+	gofile := infile + ".i.go"
+	for i := 0; i < 2; i++ { // the second build loads Go files and diagnostics from the cache
+		ret, err := Build(context.Background(), Options{Input: infile, Target: InMemory, KeepGoing: true})
+		if err != nil {
+			t.Fatal("Build:", err)
+		}
+		if len(ret.Diags) != 1 || ret.Diags.HasError() {
+			t.Fatal("Build: Diags =", ret.Diags)
+		}
+		if _, ok := ret.Files[gofile]; !ok || len(ret.Files) != 1 {
+			t.Fatal("Build: Files =", ret.Files)
+		}
+		if isFile(gofile) {
+			t.Fatal("Build: Go file is written to", gofile)
+		}
+	}
+
+	_, err := Build(context.Background(), Options{Input: infile, Target: InMemory})
+	if errs, ok := err.(cl.ErrorList); !ok || !errs.HasError() {
+		t.Fatal("Build: err =", err)
+	}
+	_, err = Build(context.Background(), Options{Input: infile, RunApp: true, Target: InMemory})
+	if err != ErrNeedOSTarget {
+		t.Fatal("Build: err =", err)
+	}
+}
+
+func TestNewError(t *testing.T) {
+	if err := newError("foo"); err.Error() != "foo" {
+		t.Fatal("newError:", err)
+	}
+	if err := newError(1); err == nil || err.Error() != "1" {
+		t.Fatal("newError:", err)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -18,6 +18,7 @@ package c2go
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -28,9 +29,8 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/goplus/gox"
 	"github.com/weblfe/c2go/cl"
-	"github.com/weblfe/c2go/clang/parser"
-	"github.com/weblfe/c2go/clang/preprocessor"
 )
 
 const (
@@ -41,8 +41,9 @@ const (
 	FlagForcePreprocess
 	FlagDumpJson
 	FlagTestMain
-
-	flagChdir
+	FlagKeepGoing
+	FlagArchNeutral
+	FlagLayoutTest
 )
 
 func isDir(name string) bool {
@@ -61,91 +62,145 @@ func isFile(name string) bool {
 
 type Config struct {
 	Select string
+
+	// Jobs specifies how many packages (or C files of a project) can be
+	// processed in parallel. It means 1 if Jobs <= 0.
+	Jobs int
+
+	// OutDir specifies a directory to put all intermediate and generated files
+	// in, which mirrors layout of the source tree. If empty, files are put next
+	// to C files (or in directories that c2go.cfg specifies).
+	OutDir string
+
+	// Triple specifies the target which C files are compiled for, eg.
+	// "i386-linux-gnu". It decides sizes of long, size_t and pointers, if char
+	// is signed, and results of sizeof/offsetof. Default is the host.
+	Triple string
+}
+
+func (p *Config) jobs() int {
+	if p == nil {
+		return 1
+	}
+	return p.Jobs
+}
+
+func (p *Config) triple() string {
+	if p == nil {
+		return ""
+	}
+	return p.Triple
 }
 
+func (p *Config) outDir() string {
+	if p == nil {
+		return ""
+	}
+	return p.OutDir
+}
+
+// Run translates infile into Go. It panics if fails. See Build for more
+// information.
 func Run(pkgname, infile string, flags int, conf *Config) {
-	outfile := infile
+	out := newOutput(context.Background(), os.Stdout, os.Stderr, OSTarget)
+	if _, err := build(pkgname, infile, flags, conf, out); err != nil {
+		log.Panicln(err)
+	}
+}
+
+func run(pkgname, infile string, flags int, conf *Config, out *output) {
+	var tu transUnit
 	switch filepath.Ext(infile) {
 	case ".i":
+		out = out.mirror(filepath.Dir(infile), conf.outDir())
+		tu = parseOnly(infile, out.arch.Flags())
 	case ".c":
-		outfile = infile + ".i"
-		err := preprocessor.Do(infile, outfile, nil)
-		check(err)
+		out = out.mirror(filepath.Dir(infile), conf.outDir())
+		tu = theCache.preprocess(infile, out.outPath(infile+".i"), out.ppConfig(), out.arch.Flags(), (flags&FlagForcePreprocess) != 0)
 	default:
 		if strings.HasSuffix(infile, "/...") {
 			infile = strings.TrimSuffix(infile, "/...")
-			err := execDirRecursively(infile, flags, conf)
+			out = out.mirror(infile, conf.outDir())
+			err := execDirRecursively(infile, flags, conf, out)
 			check(err)
 		} else if isDir(infile) {
+			out = out.mirror(infile, conf.outDir())
 			projfile := filepath.Join(infile, "c2go.cfg")
 			if isFile(projfile) {
-				execProj(projfile, flags, conf)
+				execProj(projfile, flags, conf, out)
 				return
 			}
-			n, err := execDir(pkgname, infile, flags)
+			n, err := execDir(pkgname, infile, flags, out)
 			check(err)
-			switch n {
-			case 1:
-			case 0:
+			if n == 0 {
 				fatalf("no *.c files in this directory.\n")
-			default:
-				fatalf("multiple .c files found (currently only support one .c file).\n")
 			}
 		} else {
 			fatalf("%s is not a .c file.\n", infile)
 		}
 		return
 	}
-	execFile(pkgname, outfile, flags|flagChdir)
+	execFile(pkgname, filepath.Dir(infile), tu, flags, out)
 	return
 }
 
-func execDirRecursively(dir string, flags int, conf *Config) (last error) {
+func execDirRecursively(dir string, flags int, conf *Config, out *output) (last error) {
 	if strings.HasPrefix(dir, "_") {
 		return
 	}
-
-	projfile := filepath.Join(dir, "c2go.cfg")
-	if isFile(projfile) {
-		fmt.Printf("==> Compiling %s ...\n", dir)
-		execProj(projfile, flags, conf)
-		return
+	var action string
+	switch {
+	case (flags & FlagRunTest) != 0:
+		action = "Testing"
+	case (flags & FlagRunApp) != 0:
+		action = "Running"
+	default:
+		action = "Compiling"
 	}
+	dirs := collectDirs(nil, dir)
+	return parallel(len(dirs), conf.jobs(), out, func(i int, out *output) error {
+		dir := dirs[i]
+		projfile := filepath.Join(dir, "c2go.cfg")
+		if isFile(projfile) {
+			fmt.Fprintf(out.stdout, "==> Compiling %s ...\n", dir)
+			execProj(projfile, flags, conf, out)
+			return nil
+		}
+		fmt.Fprintf(out.stdout, "==> %s %s ...\n", action, dir)
+		_, err := execDir("main", dir, flags, out)
+		if err != nil {
+			fmt.Fprintln(out.stderr, err)
+		}
+		return err
+	})
+}
 
-	fis, last := os.ReadDir(dir)
-	check(last)
+// collectDirs appends all directories to process under dir (projects, or
+// directories which have *.c files) to dirs. Subdirectories are collected
+// before their parent.
+func collectDirs(dirs []string, dir string) []string {
+	if isFile(filepath.Join(dir, "c2go.cfg")) {
+		return append(dirs, dir)
+	}
+	fis, err := os.ReadDir(dir)
+	check(err)
 	var cfiles int
 	for _, fi := range fis {
 		if fi.IsDir() {
-			pkgDir := filepath.Join(dir, fi.Name())
-			if e := execDirRecursively(pkgDir, flags, conf); e != nil {
-				last = e
-			}
+			dirs = collectDirs(dirs, filepath.Join(dir, fi.Name()))
 			continue
 		}
 		if strings.HasSuffix(fi.Name(), ".c") {
 			cfiles++
 		}
 	}
-	if cfiles == 1 {
-		var action string
-		switch {
-		case (flags & FlagRunTest) != 0:
-			action = "Testing"
-		case (flags & FlagRunApp) != 0:
-			action = "Running"
-		default:
-			action = "Compiling"
-		}
-		fmt.Printf("==> %s %s ...\n", action, dir)
-		if _, e := execDir("main", dir, flags); e != nil {
-			last = e
-		}
+	if cfiles > 0 {
+		dirs = append(dirs, dir)
 	}
-	return
+	return dirs
 }
 
-func execDir(pkgname string, dir string, flags int) (n int, err error) {
+func execDir(pkgname string, dir string, flags int, out *output) (n int, err error) {
 	if (flags & FlagFailFast) == 0 {
 		defer func() {
 			if e := recover(); e != nil {
@@ -155,98 +210,182 @@ func execDir(pkgname string, dir string, flags int) (n int, err error) {
 	}
 	n = -1
 
-	cwd := chdir(dir)
-	defer os.Chdir(cwd)
-
-	var infile, outfile string
-	files, err := filepath.Glob("*.c")
+	files, err := filepath.Glob(filepath.Join(dir, "*.c"))
 	check(err)
 	switch n = len(files); n {
+	case 0:
 	case 1:
-		infile = files[0]
-		outfile = infile + ".i"
-		err = preprocessor.Do(infile, outfile, nil)
-		check(err)
-		execFile(pkgname, outfile, flags)
+		infile := files[0]
+		tu := theCache.preprocess(infile, out.outPath(infile+".i"), out.ppConfig(), out.arch.Flags(), (flags&FlagForcePreprocess) != 0)
+		execFile(pkgname, dir, tu, flags, out)
+	default:
+		execFiles(pkgname, dir, files, flags, out)
 	}
 	return
 }
 
-func execFile(pkgname string, outfile string, flags int) {
-	var json []byte
-	doc, _, err := parser.ParseFileEx(outfile, 0, &parser.Config{
-		Json:   &json,
-		Stderr: true,
-	})
-	check(err)
+// execFiles compiles multiple C files into one Go package. It shares the
+// Go package instance between all these files, just like project mode does.
+func execFiles(pkgname string, dir string, infiles []string, flags int, out *output) {
+	tus := make([]transUnit, len(infiles))
+	for i, infile := range infiles {
+		out.checkCanceled()
+		tus[i] = theCache.preprocess(infile, out.outPath(infile+".i"), out.ppConfig(), out.arch.Flags(), (flags&FlagForcePreprocess) != 0)
+		dumpJson(tus[i], flags, out)
+	}
+	goDir := out.outPath(dir)
+	key := genKey(pkgname, flags, tus...)
+	if !theCache.loadGen(key, goDir, out) {
+		var reused cl.Reused
+		var diags cl.ErrorList
+		needPkgInfo := (flags & FlagDepsAutoGen) != 0
+		for _, tu := range tus {
+			out.checkCanceled()
+			_, err := cl.NewPackage("", pkgname, tu.doc(), &cl.Config{
+				SrcFile:     tu.file,
+				NeedPkgInfo: needPkgInfo,
+				NeedRecords: (flags & FlagLayoutTest) != 0,
+				Reused:      &reused,
+				KeepGoing:   (flags & FlagKeepGoing) != 0,
+				Target:      out.arch,
+				ArchNeutral: (flags & FlagArchNeutral) != 0,
+			})
+			diags = append(diags, out.checkDiags(err)...)
+		}
+		gofiles := writePkgFiles(reused.Pkg(), goDir, needPkgInfo, out)
+		writeLayoutTest(reused.Pkg(), goDir, gofiles, flags, out)
+		theCache.storeGen(key, gofiles, diags)
+	}
 
-	if (flags & FlagDumpJson) != 0 {
-		os.WriteFile(strings.TrimSuffix(outfile, ".i")+".json", json, 0666)
+	if (flags & FlagRunTest) != 0 {
+		runTest(dir, goDir, out)
+	} else if (flags & FlagRunApp) != 0 {
+		runGoApp(dir, goDir, out.stdout, out.stderr, false, out)
 	}
+}
 
-	needPkgInfo := (flags & FlagDepsAutoGen) != 0
-	pkg, err := cl.NewPackage("", pkgname, doc, &cl.Config{
-		SrcFile: outfile, NeedPkgInfo: needPkgInfo,
+// writePkgFiles writes all Go files of pkg into dir, and returns them keyed
+// by file name.
+func writePkgFiles(pkg cl.Package, dir string, needPkgInfo bool, out *output) map[string][]byte {
+	dir = out.outPath(dir)
+	gofiles := make(map[string][]byte)
+	pkg.ForEachFile(func(fname string, file *gox.File) {
+		gofile := fname
+		if strings.HasPrefix(fname, "_") {
+			gofile = "x2g" + fname
+		}
+		gofiles[gofile] = out.writeFileBy(filepath.Join(dir, gofile), func(w io.Writer) error {
+			return pkg.WriteTo(w, fname)
+		})
 	})
-	check(err)
-
-	gofile := outfile + ".go"
-	err = pkg.WriteFile(gofile)
-	check(err)
-
-	dir, _ := filepath.Split(gofile)
-
 	if needPkgInfo {
-		err = pkg.WriteDepFile(filepath.Join(dir, "c2go_autogen.go"))
-		check(err)
+		gofiles["c2go_autogen.go"] = out.writeFileBy(filepath.Join(dir, "c2go_autogen.go"), pkg.WriteDepTo)
+	}
+	return gofiles
+}
+
+func dumpJson(tu transUnit, flags int, out *output) {
+	if (flags & FlagDumpJson) != 0 {
+		os.WriteFile(out.outPath(strings.TrimSuffix(tu.file, ".i")+".json"), tu.json, 0666)
 	}
+}
 
-	if (flags & flagChdir) != 0 {
-		if dir != "" {
-			cwd := chdir(dir)
-			defer os.Chdir(cwd)
+// execFile compiles a preprocessed C file of srcDir into a Go package.
+func execFile(pkgname string, srcDir string, tu transUnit, flags int, out *output) {
+	dumpJson(tu, flags, out)
+
+	gofile := out.outPath(tu.file + ".go")
+	dir, fname := filepath.Split(gofile)
+
+	key := genKey(pkgname, flags, tu)
+	if !theCache.loadGen(key, dir, out) {
+		out.checkCanceled()
+		needPkgInfo := (flags & FlagDepsAutoGen) != 0
+		pkg, err := cl.NewPackage("", pkgname, tu.doc(), &cl.Config{
+			SrcFile: tu.file, NeedPkgInfo: needPkgInfo,
+			NeedRecords: (flags & FlagLayoutTest) != 0,
+			KeepGoing:   (flags & FlagKeepGoing) != 0, Target: out.arch,
+			ArchNeutral: (flags & FlagArchNeutral) != 0,
+		})
+		diags := out.checkDiags(err)
+
+		gofiles := make(map[string][]byte)
+		gofiles[fname] = out.writeFileBy(gofile, func(w io.Writer) error {
+			return pkg.WriteTo(w)
+		})
+		if needPkgInfo {
+			gofiles["c2go_autogen.go"] = out.writeFileBy(filepath.Join(dir, "c2go_autogen.go"), pkg.WriteDepTo)
 		}
+		writeLayoutTest(pkg, dir, gofiles, flags, out)
+		theCache.storeGen(key, gofiles, diags)
 	}
 
 	if (flags & FlagRunTest) != 0 {
-		runTest("")
+		runTest(srcDir, dir, out)
 	} else if (flags & FlagRunApp) != 0 {
-		runGoApp("", os.Stdout, os.Stderr, false)
+		runGoApp(srcDir, dir, out.stdout, out.stderr, false, out)
 	}
 }
 
-func checkEqual(prompt string, a, expected []byte) {
+func checkEqual(prompt string, a, expected []byte, out *output) {
 	if bytes.Equal(a, expected) {
 		return
 	}
 
-	fmt.Fprintln(os.Stderr, "=> Result of", prompt)
-	os.Stderr.Write(a)
+	fmt.Fprintln(out.stderr, "=> Result of", prompt)
+	out.stderr.Write(a)
 
-	fmt.Fprintln(os.Stderr, "\n=> Expected", prompt)
-	os.Stderr.Write(expected)
+	fmt.Fprintln(out.stderr, "\n=> Expected", prompt)
+	out.stderr.Write(expected)
 
 	fatal(errors.New("checkEqual: unexpected " + prompt))
 }
 
-func runTest(dir string) {
+// runTest runs the Go app in goDir and the C app in srcDir, and checks if
+// their outputs are the same.
+func runTest(srcDir, goDir string, out *output) {
 	var goOut, goErr bytes.Buffer
 	var cOut, cErr bytes.Buffer
-	dontRunTest := runGoApp(dir, &goOut, &goErr, true)
+	dontRunTest := runGoApp(srcDir, goDir, &goOut, &goErr, true, out)
 	if dontRunTest {
 		return
 	}
-	runCApp(dir, &cOut, &cErr)
-	checkEqual("output", goOut.Bytes(), cOut.Bytes())
-	checkEqual("stderr", goErr.Bytes(), cErr.Bytes())
+	runCApp(srcDir, goDir, &cOut, &cErr, out)
+	checkEqual("output", goOut.Bytes(), cOut.Bytes(), out)
+	checkEqual("stderr", goErr.Bytes(), cErr.Bytes(), out)
 }
 
-func runGoApp(dir string, stdout, stderr io.Writer, doRunTest bool) (dontRunTest bool) {
-	files, err := filepath.Glob("*.go")
+// globIn returns names of files in dir which match pattern.
+func globIn(dir, pattern string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
 	check(err)
+	for i, file := range files {
+		files[i] = filepath.Base(file)
+	}
+	return files
+}
+
+// runGoApp builds Go files generated in goDir, with hand-written Go files in
+// srcDir (eg. libc.go), into goDir, and runs it there.
+func runGoApp(srcDir, goDir string, stdout, stderr io.Writer, doRunTest bool, out *output) (dontRunTest bool) {
+	files := globIn(goDir, "*.go")
+	if goDir != srcDir {
+		for _, fname := range globIn(srcDir, "*.go") {
+			if !isFile(filepath.Join(goDir, fname)) {
+				files = append(files, fname)
+			}
+		}
+	}
 
 	for i, n := 0, len(files); i < n; i++ {
-		fname := filepath.Base(files[i])
+		fname := files[i]
+		if strings.HasSuffix(fname, "_test.go") { // eg. c2go_layout_test.go
+			n--
+			files[i], files[n] = files[n], files[i]
+			files = files[:n]
+			i--
+			continue
+		}
 		if pos := strings.LastIndex(fname, "_"); pos >= 0 {
 			switch os := fname[pos+1 : len(fname)-3]; os {
 			case "darwin", "linux", "windows":
@@ -262,69 +401,94 @@ func runGoApp(dir string, stdout, stderr io.Writer, doRunTest bool) (dontRunTest
 
 	if doRunTest {
 		for _, file := range files {
-			if filepath.Base(file) == "main.go" {
-				stdout, stderr = os.Stdout, os.Stderr
+			if file == "main.go" {
+				stdout, stderr = out.stdout, out.stderr
 				dontRunTest = true
 				break
 			}
 		}
 	}
-	cmd := exec.Command("go", append([]string{"run"}, files...)...)
-	cmd.Dir = dir
+	absDir, err := filepath.Abs(srcDir)
+	check(err)
+	exe, err := filepath.Abs(filepath.Join(goDir, goOut))
+	check(err)
+	args := []string{"-o", exe}
+	for _, fname := range files {
+		args = append(args, filepath.Join(absDir, fname))
+	}
+	cmd, done := out.goCommand(srcDir, "build", args...)
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
-	checkWith(cmd.Run(), stdout, stderr)
+	err = cmd.Run()
+	done()
+	out.checkWith(err, stdout, stderr)
+
+	cmd2 := exec.CommandContext(out.ctx, exe)
+	cmd2.Dir = goDir
+	cmd2.Stdout = stdout
+	cmd2.Stderr = stderr
+	err = cmd2.Run()
+	os.Remove(exe)
+	out.checkWith(err, stdout, stderr)
 	return
 }
 
-func runCApp(dir string, stdout, stderr io.Writer) {
-	files, err := filepath.Glob("*.c")
+// runCApp builds C files in srcDir into binDir, and runs it.
+func runCApp(srcDir, binDir string, stdout, stderr io.Writer, out *output) {
+	files := globIn(srcDir, "*.c")
+	exe, err := filepath.Abs(filepath.Join(binDir, clangOut))
 	check(err)
 
-	cmd := exec.Command("clang", files...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := exec.CommandContext(out.ctx, "clang", append([]string{"-o", exe}, files...)...)
+	cmd.Dir = srcDir
+	cmd.Stdout = out.stdout
+	cmd.Stderr = out.stderr
 	check(cmd.Run())
 
-	cmd2 := exec.Command(clangOut)
-	cmd.Dir = dir
+	cmd2 := exec.CommandContext(out.ctx, clangOut)
+	cmd2.Dir = binDir
 	cmd2.Stdout = stdout
 	cmd2.Stderr = stderr
-	checkWith(cmd2.Run(), stdout, stderr)
+	out.checkWith(cmd2.Run(), stdout, stderr)
 
-	os.Remove(clangOut)
+	os.Remove(exe)
 }
 
 var (
 	clangOut = "./a.out"
+	goOut    = "./go.out"
 )
 
 func init() {
 	if runtime.GOOS == "windows" {
 		clangOut = "./a.exe"
+		goOut = "./go.exe"
 	}
 }
 
-func chdir(dir string) string {
-	cwd, err := os.Getwd()
-	check(err)
-
-	err = os.Chdir(dir)
-	check(err)
-
-	return cwd
-}
-
 func check(err error) {
 	if err != nil {
 		fatal(err)
 	}
 }
 
-func checkWith(err error, stdout, stderr io.Writer) {
+// checkDiags reports diagnostics of functions stubbed out in keep-going mode,
+// and fails only if there is a real error.
+func (p *output) checkDiags(err error) cl.ErrorList {
+	if errs, ok := err.(cl.ErrorList); ok && !errs.HasError() {
+		for _, e := range errs {
+			fmt.Fprintln(p.stderr, e)
+		}
+		p.addDiags(errs)
+		return errs
+	}
+	check(err)
+	return nil
+}
+
+func (p *output) checkWith(err error, stdout, stderr io.Writer) {
 	if err != nil {
-		fatalWith(err, stdout, stderr)
+		p.fatalWith(err, stdout, stderr)
 	}
 }
 
@@ -333,14 +497,14 @@ func fatalf(format string, args ...interface{}) {
 }
 
 func fatal(err error) {
-	log.Panicln(err)
+	panic(err)
 }
 
-func fatalWith(err error, stdout, stderr io.Writer) {
+func (p *output) fatalWith(err error, stdout, stderr io.Writer) {
 	if o, ok := getBytes(stdout, stderr); ok {
-		os.Stderr.Write(o.Bytes())
+		p.stderr.Write(o.Bytes())
 	}
-	log.Panicln(err)
+	panic(err)
 }
 
 func newError(v interface{}) error {
@@ -350,8 +514,7 @@ func newError(v interface{}) error {
 	case string:
 		return errors.New(e)
 	}
-	fatalf("newError failed: %v", v)
-	return nil
+	return fmt.Errorf("%v", v)
 }
 
 type iBytes interface {
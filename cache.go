@@ -0,0 +1,452 @@
+/*
+ * Copyright (c) 2022 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package c2go
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/weblfe/c2go/cl"
+	"github.com/weblfe/c2go/clang/ast"
+	"github.com/weblfe/c2go/clang/parser"
+	"github.com/weblfe/c2go/clang/preprocessor"
+)
+
+// -----------------------------------------------------------------------------
+
+// buildCache is a content-addressed cache of translation results. It is
+// located in $C2GO_CACHE (default: $UserCacheDir/c2go), and C2GO_CACHE=off
+// disables it. Layout of the cache directory:
+//
+//	<srckey>.deps        headers included by a C file: "<hash> <file>" per line
+//	<tukey>/src.i        the preprocessed C file
+//	<tukey>/ast.json     AST of the preprocessed C file
+//	<genkey>/*.go        Go files generated from translation units
+//	<genkey>/diags.json  diagnostics reported when generating Go files
+//
+// srckey covers the C file, preprocessor flags and versions of clang and c2go.
+// tukey covers srckey and contents of all headers the C file includes. genkey
+// covers tukeys of all C files of a Go package and flags of c2go.
+type buildCache struct {
+	dir string // empty if the cache is disabled
+}
+
+var theCache = newBuildCache()
+
+func newBuildCache() *buildCache {
+	dir := os.Getenv("C2GO_CACHE")
+	switch dir {
+	case "off":
+		return &buildCache{}
+	case "":
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return &buildCache{}
+		}
+		dir = filepath.Join(cacheDir, "c2go")
+	}
+	return &buildCache{dir: dir}
+}
+
+// transUnit is a preprocessed C file and its AST.
+type transUnit struct {
+	file string // the preprocessed file
+	key  string // content hash of the translation unit, empty if not cached
+	json []byte // AST in json format
+}
+
+func (p *transUnit) doc() *ast.Node {
+	doc, err := parser.ParseJson(p.json)
+	check(err)
+	return doc
+}
+
+// parseOnly dumps AST of a preprocessed file which isn't cached.
+func parseOnly(outfile string, parseFlags []string) transUnit {
+	json, _, err := parser.DumpAST(outfile, &parser.Config{Flags: parseFlags, Stderr: true})
+	check(err)
+	return transUnit{file: outfile, json: json}
+}
+
+// preprocess preprocesses infile into outfile and dumps its AST. It reuses
+// results in the cache if infile, headers it includes, conf and versions of
+// tools don't change. If force is true, it always runs clang and refreshes
+// the cache.
+func (p *buildCache) preprocess(
+	infile, outfile string, conf *preprocessor.Config, parseFlags []string, force bool) (tu transUnit) {
+	if conf == nil {
+		conf = new(preprocessor.Config)
+	}
+	if p.dir == "" {
+		err := preprocessor.Do(infile, outfile, conf)
+		check(err)
+		return parseOnly(outfile, parseFlags)
+	}
+	srckey := srcKey(infile, conf, parseFlags)
+	if !force {
+		if key, ok := p.lookupDeps(srckey); ok {
+			if json, err := os.ReadFile(filepath.Join(p.dir, key, "ast.json")); err == nil {
+				if p.loadFile(key, "src.i", outfile) {
+					return transUnit{file: outfile, key: key, json: json}
+				}
+			}
+		}
+	}
+	depfile := outfile + ".d"
+	ppconf := *conf
+	ppconf.DepFile = depfile
+	err := preprocessor.Do(infile, outfile, &ppconf)
+	check(err)
+	defer os.Remove(depfile)
+
+	tu = parseOnly(outfile, parseFlags)
+	tu.key = p.storeTU(srckey, depfile, outfile, tu.json)
+	return
+}
+
+func srcKey(infile string, conf *preprocessor.Config, parseFlags []string) string {
+	h := newHasher("src")
+	compiler := conf.Compiler
+	if compiler == "" {
+		compiler = "clang"
+	}
+	abs, _ := filepath.Abs(infile)
+	h.add("file", infile, abs, hashFileOrEmpty(infile))
+	h.add("cc", compiler, clangVersion(compiler))
+	h.add("clang", clangVersion("clang"))
+	h.add("pp", conf.PPFlag, conf.BaseDir)
+	h.add("include", conf.IncludeDirs...)
+	h.add("define", conf.Defines...)
+	h.add("flags", conf.Flags...)
+	h.add("parse", parseFlags...)
+	return h.sum()
+}
+
+// lookupDeps checks if headers included by a C file change, and returns key
+// of the translation unit if not.
+func (p *buildCache) lookupDeps(srckey string) (key string, ok bool) {
+	b, err := os.ReadFile(filepath.Join(p.dir, srckey+".deps"))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line == "" {
+			continue
+		}
+		pos := strings.IndexByte(line, ' ')
+		if pos < 0 || hashFileOrEmpty(line[pos+1:]) != line[:pos] {
+			return
+		}
+	}
+	return tuKey(srckey, b), true
+}
+
+func (p *buildCache) storeTU(srckey, depfile, outfile string, json []byte) string {
+	b, err := os.ReadFile(depfile)
+	if err != nil {
+		return ""
+	}
+	var deps bytes.Buffer
+	for _, dep := range parseDepFile(b) {
+		h := hashFileOrEmpty(dep)
+		if h == "" {
+			return ""
+		}
+		fmt.Fprintf(&deps, "%s %s\n", h, dep)
+	}
+	src, err := os.ReadFile(outfile)
+	if err != nil {
+		return ""
+	}
+	key := tuKey(srckey, deps.Bytes())
+	if p.store(key, map[string][]byte{"src.i": src, "ast.json": json}) != nil {
+		return ""
+	}
+	if writeFileAtomic(filepath.Join(p.dir, srckey+".deps"), deps.Bytes()) != nil {
+		return ""
+	}
+	return key
+}
+
+func tuKey(srckey string, deps []byte) string {
+	h := newHasher("tu")
+	h.add("src", srckey)
+	h.Write(deps)
+	return h.sum()
+}
+
+// genKey returns key of Go files generated from tus. It returns an empty
+// string if any of tus isn't cached.
+func genKey(pkgname string, flags int, tus ...transUnit) string {
+	h := newHasher("gen")
+	h.add("pkg", pkgname)
+	h.add("flags", fmt.Sprint(flags&(FlagDepsAutoGen|FlagTestMain|FlagKeepGoing|FlagArchNeutral|FlagLayoutTest)))
+	for _, tu := range tus {
+		if tu.key == "" {
+			return ""
+		}
+		h.add("tu", tu.key)
+	}
+	return h.sum()
+}
+
+// loadGen writes Go files cached with key into dir, and reports diagnostics
+// when generating them. It returns false if they aren't in the cache.
+func (p *buildCache) loadGen(key, dir string, out *output) bool {
+	if p.dir == "" || key == "" {
+		return false
+	}
+	entry := filepath.Join(p.dir, key)
+	fis, err := os.ReadDir(entry)
+	if err != nil {
+		return false
+	}
+	gofiles := make(map[string][]byte, len(fis))
+	var diags cl.ErrorList
+	for _, fi := range fis {
+		b, err := os.ReadFile(filepath.Join(entry, fi.Name()))
+		if err != nil {
+			return false
+		}
+		if fname := fi.Name(); fname == "diags.json" {
+			if json.Unmarshal(b, &diags) != nil {
+				return false
+			}
+		} else {
+			gofiles[fname] = b
+		}
+	}
+	for fname, b := range gofiles {
+		out.writeFile(filepath.Join(dir, fname), b)
+	}
+	for _, e := range diags {
+		fmt.Fprintln(out.stderr, e)
+	}
+	out.addDiags(diags)
+	return true
+}
+
+// storeGen caches Go files (keyed by file name) generated from translation
+// units, with diagnostics when generating them.
+func (p *buildCache) storeGen(key string, gofiles map[string][]byte, diags cl.ErrorList) {
+	if p.dir == "" || key == "" {
+		return
+	}
+	files := gofiles
+	if len(diags) > 0 {
+		b, err := json.Marshal(diags)
+		if err != nil {
+			return
+		}
+		files = make(map[string][]byte, len(gofiles)+1)
+		for fname, data := range gofiles {
+			files[fname] = data
+		}
+		files["diags.json"] = b
+	}
+	p.store(key, files)
+}
+
+// loadFile copies file fname of a cache entry to dst, if dst differs from it.
+func (p *buildCache) loadFile(key, fname, dst string) bool {
+	b, err := os.ReadFile(filepath.Join(p.dir, key, fname))
+	if err != nil {
+		return false
+	}
+	if old, err := os.ReadFile(dst); err == nil && bytes.Equal(old, b) {
+		return true
+	}
+	return os.WriteFile(dst, b, 0666) == nil
+}
+
+// store creates a cache entry. Entries are immutable: if the entry exists,
+// it has the same content because its key is a content hash.
+func (p *buildCache) store(key string, files map[string][]byte) error {
+	err := os.MkdirAll(p.dir, 0777)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(p.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	for fname, b := range files {
+		if err = os.WriteFile(filepath.Join(tmp, fname), b, 0666); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+	}
+	entry := filepath.Join(p.dir, key)
+	if err = os.Rename(tmp, entry); err != nil {
+		os.RemoveAll(tmp)
+		if isDir(entry) {
+			return nil
+		}
+	}
+	return err
+}
+
+func writeFileAtomic(name string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// parseDepFile parses a depfile generated by -MD, and returns all its
+// prerequisites.
+func parseDepFile(b []byte) (deps []string) {
+	s := strings.ReplaceAll(string(b), "\\\r\n", " ")
+	s = strings.ReplaceAll(s, "\\\n", " ")
+	if pos := strings.Index(s, ": "); pos >= 0 { // skip target
+		s = s[pos+2:]
+	}
+	dep := make([]byte, 0, 128)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\r', '\n':
+			if len(dep) > 0 {
+				deps = append(deps, string(dep))
+				dep = dep[:0]
+			}
+		case '\\', '$':
+			if i+1 < len(s) {
+				if next := s[i+1]; next == ' ' || next == '#' || (c == '$' && next == '$') {
+					dep = append(dep, next)
+					i++
+					continue
+				}
+			}
+			dep = append(dep, c)
+		default:
+			dep = append(dep, c)
+		}
+	}
+	if len(dep) > 0 {
+		deps = append(deps, string(dep))
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+type hasher struct {
+	hash.Hash
+}
+
+func newHasher(kind string) hasher {
+	h := hasher{sha256.New()}
+	fmt.Fprintf(h, "c2go %s %s\n", kind, c2goVersion())
+	return h
+}
+
+func (h hasher) add(name string, vals ...string) {
+	fmt.Fprintf(h, "%s %q\n", name, vals)
+}
+
+func (h hasher) sum() string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashFileOrEmpty returns content hash of a file, or an empty string if the
+// file can't be read.
+func hashFileOrEmpty(name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var (
+	clangVers  = make(map[string]string)
+	clangMutex sync.Mutex
+)
+
+func clangVersion(compiler string) string {
+	clangMutex.Lock()
+	defer clangMutex.Unlock()
+	ver, ok := clangVers[compiler]
+	if !ok {
+		b, err := exec.Command(compiler, "--version").Output()
+		if err != nil {
+			ver = "error: " + err.Error()
+		} else {
+			ver = string(b)
+		}
+		clangVers[compiler] = ver
+	}
+	return ver
+}
+
+var (
+	c2goVer     string
+	c2goVerOnce sync.Once
+)
+
+const c2goModPath = "github.com/weblfe/c2go"
+
+// c2goVersion returns version of c2go module. For a development build, it
+// returns content hash of the executable instead.
+func c2goVersion() string {
+	c2goVerOnce.Do(func() {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			if bi.Main.Path == c2goModPath {
+				c2goVer = bi.Main.Version
+			}
+			for _, m := range bi.Deps {
+				if m.Path == c2goModPath && m.Replace == nil {
+					c2goVer = m.Version
+				}
+			}
+		}
+		if c2goVer == "" || c2goVer == "(devel)" {
+			if exe, err := os.Executable(); err == nil {
+				c2goVer = "devel " + hashFileOrEmpty(exe)
+			}
+		}
+	})
+	return c2goVer
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,112 @@
+package c2go
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/weblfe/c2go/clang/preprocessor"
+	ctypes "github.com/weblfe/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestParseDepFile(t *testing.T) {
+	b := "foo.c.i: foo.c /usr/include/stdio.h \\\n  my\\ dir/a.h cost$$.h \\\r\n\tc\\#d.h\n"
+	deps := parseDepFile([]byte(b))
+	want := []string{"foo.c", "/usr/include/stdio.h", "my dir/a.h", "cost$.h", "c#d.h"}
+	if !reflect.DeepEqual(deps, want) {
+		t.Fatal("parseDepFile:", deps)
+	}
+}
+
+// storeTestTU caches a translation unit of infile which includes headers, and
+// returns its key.
+func storeTestTU(t *testing.T, cache *buildCache, srckey, infile string, json []byte, headers ...string) string {
+	outfile := infile + ".i"
+	depfile := outfile + ".d"
+	deps := outfile + ":"
+	for _, dep := range append([]string{infile}, headers...) {
+		deps += " " + dep
+	}
+	writeTestFiles(t, "", map[string]string{outfile: "int x;\n", depfile: deps + "\n"})
+	key := cache.storeTU(srckey, depfile, outfile, json)
+	if key == "" {
+		t.Fatal("storeTU failed")
+	}
+	return key
+}
+
+func TestCacheHeaderChanged(t *testing.T) {
+	dir := t.TempDir()
+	cache := &buildCache{dir: filepath.Join(dir, "cache")}
+	infile, header := filepath.Join(dir, "foo.c"), filepath.Join(dir, "foo.h")
+	writeTestFiles(t, "", map[string]string{infile: "#include \"foo.h\"\n", header: "int x;\n"})
+
+	srckey := srcKey(infile, &preprocessor.Config{}, nil)
+	key := storeTestTU(t, cache, srckey, infile, []byte("{}"), header)
+	if ret, ok := cache.lookupDeps(srckey); !ok || ret != key {
+		t.Fatal("lookupDeps:", ret, ok)
+	}
+	writeTestFiles(t, "", map[string]string{header: "long x;\n"})
+	if _, ok := cache.lookupDeps(srckey); ok {
+		t.Fatal("lookupDeps: header changed, but the cache is hit")
+	}
+	os.Remove(header)
+	if _, ok := cache.lookupDeps(srckey); ok {
+		t.Fatal("lookupDeps: header removed, but the cache is hit")
+	}
+}
+
+func TestCacheConfChanged(t *testing.T) {
+	dir := t.TempDir()
+	cache := &buildCache{dir: filepath.Join(dir, "cache")}
+	infile := filepath.Join(dir, "foo.c")
+	writeTestFiles(t, "", map[string]string{infile: "int x;\n"})
+	targetFlags := func(triple string) []string {
+		target, err := ctypes.ParseTarget(triple)
+		if err != nil {
+			t.Fatal("ParseTarget:", err)
+		}
+		return target.Flags()
+	}
+
+	amd64 := targetFlags("x86_64-linux-gnu")
+	srckey := srcKey(infile, &preprocessor.Config{Flags: amd64}, amd64)
+	storeTestTU(t, cache, srckey, infile, []byte("{}"))
+	if _, ok := cache.lookupDeps(srckey); !ok {
+		t.Fatal("lookupDeps: cache isn't hit")
+	}
+	i386 := targetFlags("i386-linux-gnu")
+	for i, conf := range []struct {
+		pp    *preprocessor.Config
+		parse []string
+	}{
+		{&preprocessor.Config{Flags: i386}, i386},
+		{&preprocessor.Config{Flags: append([]string{"-O2"}, amd64...)}, amd64},
+		{&preprocessor.Config{Flags: amd64, Defines: []string{"NDEBUG"}}, amd64},
+		{&preprocessor.Config{Flags: amd64, IncludeDirs: []string{"include"}}, amd64},
+		{&preprocessor.Config{Flags: amd64, Compiler: "gcc"}, amd64},
+	} {
+		if _, ok := cache.lookupDeps(srcKey(infile, conf.pp, conf.parse)); ok {
+			t.Fatal("lookupDeps: conf changed, but the cache is hit -", i)
+		}
+	}
+	writeTestFiles(t, "", map[string]string{infile: "long x;\n"})
+	if _, ok := cache.lookupDeps(srcKey(infile, &preprocessor.Config{Flags: amd64}, amd64)); ok {
+		t.Fatal("lookupDeps: C file changed, but the cache is hit")
+	}
+	tu := transUnit{key: "tu"}
+	if genKey("main", FlagKeepGoing, tu) == genKey("main", FlagArchNeutral, tu) {
+		t.Fatal("genKey: flags don't change the key")
+	}
+	if genKey("main", FlagKeepGoing, tu) != genKey("main", FlagKeepGoing|FlagRunApp, tu) {
+		t.Fatal("genKey: flags which don't affect generated files change the key")
+	}
+	if key := genKey("main", 0, tu, transUnit{}); key != "" {
+		t.Fatalf("genKey: %q, a translation unit isn't cached", key)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,234 @@
+package cl
+
+import (
+	"go/token"
+	"go/types"
+	"log"
+
+	"github.com/goplus/gox"
+	"github.com/weblfe/c2go/clang/ast"
+
+	ctypes "github.com/weblfe/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// Alignment of a C type may be greater than alignment of the Go type which it
+// is translated to, if a record or a field is over-aligned by `_Alignas(N)` or
+// `__attribute__((aligned(N)))`. So padding fields `_ [n]byte` are inserted
+// before an over-aligned field and at the end of an over-aligned record, to
+// keep offsets and sizes the same as C. It may also be less than alignment in
+// Go, if a record is packed (see structBuilder).
+//
+// An over-aligned variable is translated into a pointer to an aligned memory
+// block, and references of it are translated into *x:
+//
+//	var x *T = (*T)(clang.AlignedAlloc(sizeof(T), N))
+
+var (
+	alignedAllocFn = newAlignedAllocFunc()
+)
+
+func newAlignedAllocFunc() *types.Func {
+	sig := newClangSig(nil, []types.Type{tyUintptr, tyUintptr}, []types.Type{ctypes.UnsafePointer})
+	fn := types.NewFunc(token.NoPos, clangPkg, "AlignedAlloc", sig)
+	clangPkg.Scope().Insert(fn)
+	return fn
+}
+
+// alignof returns alignment of typ in C.
+func (p *blockCtx) alignof(typ types.Type) int {
+	switch t := typ.(type) {
+	case *types.Named:
+		if align, ok := p.aligns[t]; ok {
+			return align
+		}
+	case *types.Array:
+		return p.alignof(t.Elem())
+	}
+	return int(p.sizes.Alignof(typ))
+}
+
+// prefAlignof returns the preferred alignment of typ (__alignof__ of GNU C),
+// which is 8 for double and long long even if they are 4 aligned in records.
+func (p *blockCtx) prefAlignof(typ types.Type) int {
+	align := p.alignof(typ)
+	if t, ok := typ.Underlying().(*types.Basic); ok && align < 8 && p.sizeof(t) == 8 {
+		return 8
+	}
+	return align
+}
+
+// setLayout checks size of the Go struct t is size, its size in C. And it
+// records align as alignment of t, if it isn't alignment of t in Go.
+func (p *blockCtx) setLayout(t *types.Named, struc *types.Struct, size, align int) {
+	if n := int(p.sizes.Sizeof(struc)); n != size {
+		panicln(ErrLayout, "size of", t, "is", n, "in Go, but", size, "in C")
+	}
+	if align > 0 && align != int(p.sizes.Alignof(struc)) {
+		if p.aligns == nil {
+			p.aligns = make(map[*types.Named]int)
+		}
+		p.aligns[t] = align
+	}
+}
+
+// declAlign returns alignment requested by AlignedAttrs of decl, or 0 if there
+// is no AlignedAttr.
+func (p *blockCtx) declAlign(decl *ast.Node) (align int) {
+	for _, attr := range decl.Inner {
+		if attr.Kind == ast.AlignedAttr {
+			if v := p.attrAlign(attr); v > align {
+				align = v
+			}
+		}
+	}
+	return
+}
+
+func (p *blockCtx) attrAlign(attr *ast.Node) int {
+	if len(attr.Inner) > 0 { // aligned(N), _Alignas(N)
+		return int(toInt64(p, attr.Inner[0], "requested alignment is not an integer constant"))
+	}
+	if r := attr.Range; r != nil && r.Begin.Offset < r.End.Offset && int(r.End.Offset) <= len(p.src) {
+		src := p.src[r.Begin.Offset:r.End.Offset]
+		if name := ident(src, "attrAlign: unexpected attribute"); name == "_Alignas" || name == "alignas" {
+			qualType := paramsOf(src[len(name):]) // _Alignas(T)
+			return p.alignof(toType(p, &ast.Type{QualType: qualType}, 0))
+		}
+	}
+	return int(p.target.BiggestAlign) // aligned
+}
+
+// -----------------------------------------------------------------------------
+
+// compileAlignof compiles _Alignof(T) and __alignof__(T) (or expr). The latter
+// is the preferred alignment if pref is true.
+func compileAlignof(ctx *blockCtx, v *ast.Node, pref bool) {
+	var t types.Type
+	if v.ArgType != nil {
+		t = toType(ctx, v.ArgType, 0)
+	} else if len(v.Inner) > 0 {
+		t = toType(ctx, v.Inner[0].Type, 0)
+	} else {
+		qualType := ctx.paramOfTypeTrait(v)
+		if debugCompileDecl {
+			log.Println("==> alignof", qualType)
+		}
+		t = toType(ctx, &ast.Type{QualType: qualType}, 0)
+	}
+	if vla, ok := t.(*ctypes.VLA); ok {
+		t, _ = vla.Base()
+	}
+	cb := ctx.cb
+	switch align := ctx.alignof(t); {
+	case pref:
+		cb.Val(ctx.prefAlignof(t))
+	case ctx.archNeutral && alignDependent(t) && align == int(ctx.sizes.Alignof(t)): // size_t(unsafe.Alignof(T{}))
+		cb.Typ(toType(ctx, v.Type, 0))
+		ctx.unsafeAlignof(t)
+		cb.Call(1)
+	default:
+		cb.Val(align)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// overAlign returns alignment of a variable decl of typ, if it is greater than
+// alignment of the Go type typ. Otherwise it returns 0.
+func (p *blockCtx) overAlign(typ types.Type, decl *ast.Node) int {
+	align := p.alignof(typ)
+	if v := p.declAlign(decl); v > align {
+		align = v
+	}
+	if align > int(p.sizes.Alignof(typ)) {
+		return align
+	}
+	return 0
+}
+
+// newAlignedVar defines an over-aligned variable.
+func newAlignedVar(ctx *blockCtx, scope *types.Scope, typ types.Type, decl *ast.Node, align int) {
+	if hasPointers(typ) {
+		panicln(ErrNotImpl, "TODO: over-aligned variable which holds pointers -", decl.Name)
+	}
+	pkg, cb := ctx.pkg, ctx.cb
+	ptr := ctypes.NewPointer(typ)
+	varDecl, inVBlock := ctx.newVar(scope, ctx.goNodePos(decl), ptr, decl.Name)
+	obj := gox.Lookup(scope, decl.Name)
+	if inVBlock {
+		cb.VarRef(obj)
+	} else {
+		cb = varDecl.InitStart(pkg)
+	}
+	cb.Typ(ptr).Val(alignedAllocFn)
+	if ctx.isNeutralSize(typ) {
+		ctx.unsafeSizeof(typ)
+	} else {
+		cb.Val(ctx.sizeof(typ))
+	}
+	cb.Val(align).Call(2).Call(1)
+	if inVBlock {
+		cb.Assign(1)
+	} else {
+		cb.EndInit(1)
+	}
+	ctx.alignedVars[obj] = none{}
+	if initExpr := varInitExpr(decl); initExpr != nil { // *x = init
+		if _, ok := checkUnion(ctx, typ); ok {
+			panicln(ErrNotImpl, "TODO: initialize over-aligned union -", decl.Name)
+		}
+		global := scope == pkg.Types.Scope()
+		if global {
+			pkg.NewFunc(nil, "init", nil, nil, false).BodyStart(pkg)
+		}
+		cb.Val(obj).ElemRef()
+		varInit(ctx, typ, initExpr)
+		cb.Assign(1)
+		if global {
+			cb.End()
+		}
+	}
+}
+
+// newExternAlignedVar declares an extern over-aligned variable, which is a
+// pointer defined by newAlignedVar (maybe in another file).
+func newExternAlignedVar(ctx *blockCtx, scope *types.Scope, typ types.Type, decl *ast.Node) {
+	obj := types.NewVar(ctx.goNodePos(decl), ctx.pkg.Types, decl.Name, ctypes.NewPointer(typ))
+	if scope.Insert(obj) == nil {
+		ctx.alignedVars[obj] = none{}
+	}
+}
+
+// isAlignedVar reports whether obj is an over-aligned variable.
+func (p *blockCtx) isAlignedVar(obj types.Object) bool {
+	_, ok := p.alignedVars[obj]
+	return ok
+}
+
+// hasPointers reports whether a value of typ holds pointers.
+func hasPointers(typ types.Type) bool {
+	switch t := typ.(type) {
+	case *types.Basic:
+		switch t.Kind() {
+		case types.UnsafePointer, types.String:
+			return true
+		}
+	case *types.Array:
+		return hasPointers(t.Elem())
+	case *types.Named:
+		return hasPointers(t.Underlying())
+	case *types.Struct:
+		for i, n := 0, t.NumFields(); i < n; i++ {
+			if hasPointers(t.Field(i).Type()) {
+				return true
+			}
+		}
+	default:
+		return true
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
@@ -24,10 +24,15 @@ const (
 // -----------------------------------------------------------------------------
 
 type funcCtx struct {
-	labels map[string]*gox.Label
-	vdefs  *gox.VarDefs
-	basel  int
-	basev  int
+	labels    map[string]*gox.Label
+	vdefs     *gox.VarDefs
+	setjmps   map[*ast.Node]int // setjmp point of statements and setjmp calls
+	jmpLabels []*gox.Label      // labels of setjmp points
+	jmpFrame  types.Object      // clang.JmpFrame of the function
+	addrs     map[string]int    // index of labels whose addresses are taken (&&label)
+	addrBase  types.Object      // [N]byte array, &addrBase[i] is address of label i
+	basel     int
+	basev     int
 }
 
 func newFuncCtx(pkg *gox.Package, complicated bool) *funcCtx {
@@ -165,8 +170,10 @@ func (p *ifCtx) elseLabel(ctx *blockCtx) *gox.Label {
 
 type loopCtx struct {
 	endLabelCtx
-	parent flowCtx
-	start  *gox.Label
+	parent  flowCtx
+	start   *gox.Label
+	post    *gox.Label // label of post statement of a for loop
+	hasPost bool
 }
 
 func (p *loopCtx) Parent() flowCtx {
@@ -174,6 +181,12 @@ func (p *loopCtx) Parent() flowCtx {
 }
 
 func (p *loopCtx) ContinueLabel(ctx *blockCtx) *gox.Label {
+	if p.hasPost {
+		if p.post == nil {
+			p.post = ctx.curfn.newLabel(ctx.cb)
+		}
+		return p.post
+	}
 	return p.start
 }
 
@@ -206,8 +219,19 @@ type blockCtx struct {
 	file     *token.File
 	curfn    *funcCtx
 	curflow  flowCtx
+	curnode  *ast.Node // node being compiled
+	diags    ErrorList
+	markers  []lineMarker
 	multiFileCtl
-	testMain bool
+	testMain  bool
+	keepGoing bool
+	target    *ctypes.Target
+	sizes     types.Sizes
+
+	packs []packState       // states of #pragma pack
+	vlas  map[ast.ID]vlaObj // declarations of VLAs and pointers to VLA, see setVLA
+
+	archNeutral bool
 }
 
 func (p *blockCtx) deleteUnnamed(id ast.ID) {
@@ -366,13 +390,14 @@ func paramsOf(v []byte) string {
 	return strings.TrimPrefix(strings.TrimLeft(string(v), space), "(")
 }
 
-func (p *blockCtx) paramOfSizeof(v *ast.Node) string {
+func (p *blockCtx) paramOfTypeTrait(v *ast.Node) string {
 	src := p.src
 	off := v.Range.Begin.Offset
 	n := int64(v.Range.Begin.TokLen)
-	op := string(src[off : off+n])
-	if op != "sizeof" {
-		log.Panicln("unknown sizeofOp:", op)
+	switch op := string(src[off : off+n]); op {
+	case "sizeof", "_Alignof", "alignof", "__alignof__", "__alignof":
+	default:
+		log.Panicln("unknown typeTraitOp:", op)
 	}
 	return paramsOf(src[off+n : v.Range.End.Offset])
 }
@@ -395,8 +420,15 @@ func ident(b []byte, msg string) string {
 	return string(b[:idx])
 }
 
+func (p *blockCtx) initTarget(target *ctypes.Target) {
+	if target == nil {
+		target = ctypes.Host
+	}
+	p.target, p.sizes = target, target.Sizes()
+}
+
 func (p *blockCtx) sizeof(typ types.Type) int {
-	return int(p.pkg.Sizeof(typ))
+	return int(p.sizes.Sizeof(typ))
 }
 
 func (p *blockCtx) offsetof(typ types.Type, name string) int {
@@ -404,13 +436,18 @@ retry:
 	switch t := typ.(type) {
 	case *types.Struct:
 		if flds, idx := getFld(t, name, 0); idx >= 0 {
-			return int(p.pkg.Offsetsof(flds)[idx])
+			return int(p.sizes.Offsetsof(flds)[idx])
 		}
 	case *types.Named:
+		if mfs, ok := p.getMisaligned(t); ok {
+			if off, ok := mfs.offsetof(name); ok {
+				return off
+			}
+		}
 		typ = t.Underlying()
 		goto retry
 	}
-	log.Panicf("offsetof(%v, %v): field not found", typ, name)
+	panicln(ErrNotImpl, "TODO: offsetof - field not found:", typ, name)
 	return -1
 }
 
@@ -506,13 +543,13 @@ func aliasCType(scope *types.Scope, pkg *types.Package, name string, c *gox.PkgR
 func (p *blockCtx) initCTypes() {
 	pkg := p.pkg.Types
 	scope := pkg.Scope()
-	p.tyI128 = ctypes.NotImpl
-	p.tyU128 = ctypes.NotImpl
+	p.tyI128 = tyInt128.Named
+	p.tyU128 = tyUint128.Named
 
 	aliasType(scope, pkg, "__int128", p.tyI128)
 	aliasType(scope, pkg, "void", ctypes.Void)
 
-	aliasType(scope, pkg, "char", types.Typ[types.Int8])
+	aliasType(scope, pkg, "char", p.target.Char())
 	aliasType(scope, pkg, "float", types.Typ[types.Float32])
 	aliasType(scope, pkg, "double", types.Typ[types.Float64])
 	aliasType(scope, pkg, "_Bool", types.Typ[types.Bool])
@@ -10,6 +10,7 @@ import (
 	"math/big"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/goplus/gox"
 
@@ -94,7 +95,60 @@ func decl_builtin(ctx *blockCtx) {
 
 // -----------------------------------------------------------------------------
 
+// layout computes alignment of fields and records in C.
+type layout struct {
+	align  int  // alignment of the record in C
+	pack   int  // max alignment of fields (#pragma pack), or 0 if not limited
+	packed bool // the record is packed
+}
+
+// newRecordLayout returns layout of a record by its attributes packed and
+// max_field_alignment (#pragma pack). The attribute aligned is handled with
+// fields, since it may be after fields.
+func newRecordLayout(ctx *blockCtx, rec *cast.Node) layout {
+	return layout{pack: ctx.recordPack(rec), packed: hasAttr(rec, cast.PackedAttr)}
+}
+
+// Align requests alignment of the record to be align at least.
+func (p *layout) Align(align int) {
+	if align > p.align {
+		p.align = align
+	}
+}
+
+// fieldAlign returns alignment of a field of typ in C. attrAlign is alignment
+// requested by aligned attributes of the field, or 0 if there isn't any.
+func (p *layout) fieldAlign(ctx *blockCtx, typ types.Type, attrAlign int, packed bool) int {
+	align := ctx.alignof(typ)
+	if packed || p.packed {
+		align = 1
+	}
+	if attrAlign > align {
+		align = attrAlign
+	}
+	if p.pack > 0 && align > p.pack {
+		align = p.pack
+	}
+	p.Align(align)
+	return align
+}
+
+// size returns size of the record in C, whose fields take size bytes.
+func (p *layout) size(size int) int {
+	if p.align > 1 {
+		return roundUp(size, p.align)
+	}
+	return size
+}
+
+func roundUp(n, align int) int {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// -----------------------------------------------------------------------------
+
 type unionBuilder struct {
+	layout
 	fields []*gox.UnionField
 }
 
@@ -140,14 +194,27 @@ func (p *unionBuilder) Type(ctx *blockCtx, t *types.Named) *types.Struct {
 		pkg.SetVFields(t, gox.NewUnionFields(fields))
 		fld := types.NewField(fldLargest.Pos, pkg.Types, fldLargest.Name, fldLargest.Type, false)
 		flds = append(flds, fld)
+		flds = appendPad(ctx, flds, p.size(lenLargest)-lenLargest)
 	}
-	return types.NewStruct(flds, nil)
+	struc := types.NewStruct(flds, nil)
+	ctx.setLayout(t, struc, p.size(lenLargest), p.align)
+	return struc
 }
 
 func (p *unionBuilder) Field(ctx *blockCtx, pos token.Pos, typ types.Type, name string, embedded bool) {
+	p.field(ctx, pos, typ, name, embedded, 0, false)
+}
+
+// FieldWith adds a field with attributes (aligned, packed) of its decl.
+func (p *unionBuilder) FieldWith(ctx *blockCtx, pos token.Pos, typ types.Type, decl *cast.Node) {
+	p.field(ctx, pos, typ, decl.Name, false, ctx.declAlign(decl), hasAttr(decl, cast.PackedAttr))
+}
+
+func (p *unionBuilder) field(ctx *blockCtx, pos token.Pos, typ types.Type, name string, embedded bool, attrAlign int, packed bool) {
 	if embedded {
 		name = ""
 	}
+	p.fieldAlign(ctx, typ, attrAlign, packed)
 	fld := &gox.UnionField{
 		Name: name,
 		Type: typ,
@@ -158,14 +225,27 @@ func (p *unionBuilder) Field(ctx *blockCtx, pos token.Pos, typ types.Type, name
 
 // -----------------------------------------------------------------------------
 
+// A field is a real field of the Go struct, if Go places it at the same offset
+// as C. Otherwise (eg. an int field of a packed struct, whose offset is 1), its
+// bytes are padding of the Go struct, and it is a virtual field (see
+// misalignedFields) accessed by a pointer to its offset. The garbage collector
+// doesn't scan padding bytes, so a virtual field can't hold pointers.
+//
+// A flexible array member `T a[]` (or `T a[0]`) is always a virtual field of
+// type [0]T, since Go pads a struct which ends with a zero size field. Its
+// elements are accessed past the end of the struct as C.
+
 type structBuilder struct {
+	layout
 	fields      []*types.Var
 	bitFields   []*gox.BitField
+	vFields     []*gox.UnionField // misaligned fields
 	lastFldName string
 	lastTy      types.Type
 	totalBits   int
 	leftBits    int
 	idx         int
+	off         int // offset of the next field in C
 }
 
 func newStructBuilder() *structBuilder {
@@ -173,13 +253,36 @@ func newStructBuilder() *structBuilder {
 }
 
 func (p *structBuilder) Type(ctx *blockCtx, t *types.Named) *types.Struct {
+	size := p.size(p.off)
+	p.padTo(ctx, size, int(ctx.sizes.Alignof(types.NewStruct(p.fields, nil))))
 	struc := types.NewStruct(p.fields, nil)
+	if len(p.vFields) > 0 {
+		if len(p.bitFields) > 0 {
+			panicln(ErrLayout, "TODO: bit fields in a struct with misaligned fields or flexible array members -", t)
+		}
+		ctx.pkg.SetVFields(t, &misalignedFields{gox.NewUnionFields(p.vFields)})
+	}
 	if len(p.bitFields) > 0 {
 		ctx.pkg.SetVFields(t, gox.NewBitFields(p.bitFields))
 	}
+	ctx.setLayout(t, struc, size, p.align)
 	return struc
 }
 
+// padTo appends padding to fields, if it's needed to place the next field,
+// which is goAlign aligned in Go, at off (or to make size of the struct off
+// when it is goAlign aligned).
+func (p *structBuilder) padTo(ctx *blockCtx, off, goAlign int) {
+	end := 0
+	if n := len(p.fields); n > 0 {
+		last := p.fields[n-1]
+		end = int(ctx.sizes.Offsetsof(p.fields)[n-1]) + ctx.sizeof(last.Type())
+	}
+	if roundUp(end, goAlign) != off {
+		p.fields = appendPad(ctx, p.fields, off-end)
+	}
+}
+
 func (p *structBuilder) BitField(ctx *blockCtx, typ types.Type, name string, bits int) {
 	if p.leftBits >= bits && ctypes.Identical(typ, p.lastTy) {
 		if name != "" {
@@ -192,6 +295,9 @@ func (p *structBuilder) BitField(ctx *blockCtx, typ types.Type, name string, bit
 		}
 		p.leftBits -= bits
 	} else if p.totalBits = ctx.sizeof(typ) << 3; p.totalBits >= bits {
+		if p.fieldAlign(ctx, typ, 0, false) < ctx.alignof(typ) {
+			panicln(ErrLayout, "TODO: bit fields of a packed struct -", name)
+		}
 		fldName := "Xbf_" + strconv.Itoa(p.idx)
 		p.Field(ctx, token.NoPos, typ, fldName, false)
 		p.idx++
@@ -207,16 +313,67 @@ func (p *structBuilder) BitField(ctx *blockCtx, typ types.Type, name string, bit
 		}
 	} else {
 		p.leftBits = -1
-		log.Panicln("BitField - too large bits:", bits)
+		panicln(ErrNotImpl, "TODO: BitField - too large bits:", bits)
 	}
 }
 
 func (p *structBuilder) Field(ctx *blockCtx, pos token.Pos, typ types.Type, name string, embedded bool) {
-	fld := types.NewField(pos, ctx.pkg.Types, name, typ, embedded)
-	p.fields = append(p.fields, fld)
+	p.field(ctx, pos, typ, name, embedded, 0, false)
+}
+
+// FieldWith adds a field with attributes (aligned, packed) of its decl.
+func (p *structBuilder) FieldWith(ctx *blockCtx, pos token.Pos, typ types.Type, decl *cast.Node) {
+	p.field(ctx, pos, typ, decl.Name, false, ctx.declAlign(decl), hasAttr(decl, cast.PackedAttr))
+}
+
+func (p *structBuilder) field(ctx *blockCtx, pos token.Pos, typ types.Type, name string, embedded bool, attrAlign int, packed bool) {
+	align := p.fieldAlign(ctx, typ, attrAlign, packed)
+	off := roundUp(p.off, align)
+	if goAlign := int(ctx.sizes.Alignof(typ)); isFlexible(typ) || off%goAlign != 0 || goAlign > align {
+		if embedded {
+			panicln(ErrLayout, "TODO: misaligned anonymous member -", name)
+		}
+		if hasPointers(typ) { // GC doesn't see pointers in a virtual field
+			panicln(ErrLayout, "TODO: misaligned member which holds pointers -", name)
+		}
+		p.vFields = append(p.vFields, &gox.UnionField{Name: name, Off: off, Type: typ, Pos: pos})
+	} else {
+		p.padTo(ctx, off, goAlign)
+		fld := types.NewField(pos, ctx.pkg.Types, name, typ, embedded)
+		p.fields = append(p.fields, fld)
+	}
+	p.off = off + ctx.sizeof(typ)
 	p.leftBits = -1
 }
 
+// appendPad appends a padding field `_ [n]byte` to flds if n > 0.
+func appendPad(ctx *blockCtx, flds []*types.Var, n int) []*types.Var {
+	if n > 0 {
+		pad := types.NewArray(types.Typ[types.Byte], int64(n))
+		flds = append(flds, types.NewField(token.NoPos, ctx.pkg.Types, "_", pad, false))
+	}
+	return flds
+}
+
+// isFlexible reports whether typ is type of a flexible array member.
+func isFlexible(typ types.Type) bool {
+	t, ok := typ.(*types.Array)
+	return ok && t.Len() == 0
+}
+
+func isPadding(fld *types.Var) bool {
+	return fld.Name() == "_"
+}
+
+func hasAttr(decl *cast.Node, kind cast.Kind) bool {
+	for _, attr := range decl.Inner {
+		if attr.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
 // -----------------------------------------------------------------------------
 
 func toInt64(ctx *blockCtx, v *cast.Node, emsg string) int64 {
@@ -232,7 +389,7 @@ func toInt64(ctx *blockCtx, v *cast.Node, emsg string) int64 {
 			return v
 		}
 	}
-	log.Panicln(emsg)
+	panicln(ErrNotImpl, emsg)
 	return -1
 }
 
@@ -240,6 +397,11 @@ func toInt64(ctx *blockCtx, v *cast.Node, emsg string) int64 {
 
 func typeCast(ctx *blockCtx, typ types.Type, arg *gox.Element) {
 	if !ctypes.Identical(typ, arg.Type) {
+		if is128(typ) || is128(arg.Type) {
+			cast128(ctx, typ, arg)
+			*arg = *ctx.cb.InternalStack().Pop()
+			return
+		}
 		adjustIntConst(ctx, arg, typ)
 		*arg = *ctx.cb.Typ(typ).Val(arg).Call(1).InternalStack().Pop()
 	}
@@ -262,7 +424,6 @@ func assignOp(ctx *blockCtx, op token.Token, src ast.Node) {
 	switch op {
 	case token.ADD_ASSIGN, token.SUB_ASSIGN: // ptr+=n, ptr-=n
 		if t1, ok := arg1Type.(*types.Pointer); ok {
-			elemSize := ctx.sizeof(t1.Elem())
 			arg2 := stk.Pop()
 
 			cb.UnaryOp(token.AND)
@@ -275,9 +436,7 @@ func assignOp(ctx *blockCtx, op token.Token, src ast.Node) {
 			} else {
 				stk.Push(arg2)
 			}
-			if elemSize != 1 {
-				cb.Val(elemSize).BinaryOp(token.MUL)
-			}
+			ctx.mulSizeof(t1.Elem())
 			goto done
 		}
 		fallthrough
@@ -285,12 +444,20 @@ func assignOp(ctx *blockCtx, op token.Token, src ast.Node) {
 		arg2 := stk.Get(-1)
 		typeCast(ctx, arg1Type, arg2)
 	case token.SHL_ASSIGN, token.SHR_ASSIGN:
-		// noop
+		shiftCount(ctx, arg1Type, stk.Get(-1))
 	}
 done:
 	cb.AssignOp(op, src)
 }
 
+// shiftCount converts the shift count n of x << n (or x >> n) to uint, if x or
+// n is a 128 bits integer.
+func shiftCount(ctx *blockCtx, x types.Type, n *gox.Element) {
+	if is128(x) || is128(n.Type) {
+		typeCast(ctx, types.Typ[types.Uint], n)
+	}
+}
+
 func isNegConst(v *gox.Element) bool {
 	if cval := v.CVal; cval != nil && cval.Kind() == constant.Int {
 		if v, ok := constant.Int64Val(cval); ok {
@@ -339,7 +506,6 @@ func binaryOp(ctx *blockCtx, op token.Token, v *cast.Node) {
 			}
 		}
 		if t1, ok := arg1.Type.(*types.Pointer); ok {
-			elemSize := ctx.sizeof(t1.Elem())
 			if isNegConst(arg2) { // fix: can't convert -1 to uintptr
 				cb.UnaryOp(token.SUB)
 				arg2 = stk.Get(-1)
@@ -354,9 +520,7 @@ func binaryOp(ctx *blockCtx, op token.Token, v *cast.Node) {
 				} else {
 					stk.Push(arg2)
 				}
-				if elemSize != 1 {
-					cb.Val(elemSize).BinaryOp(token.MUL)
-				}
+				ctx.mulSizeof(t1.Elem())
 				cb.BinaryOp(op, src)
 				castPtrType(cb, t1, stk.Pop())
 				return
@@ -364,15 +528,17 @@ func binaryOp(ctx *blockCtx, op token.Token, v *cast.Node) {
 				castPtrType(cb, tyUintptr, arg1)
 				castPtrType(cb, tyUintptr, arg2)
 				cb.BinaryOp(token.SUB, src)
-				if elemSize != 1 {
-					cb.Val(elemSize).BinaryOp(token.MUL)
-				}
+				diff := stk.Pop()
+				cb.Typ(toType(ctx, v.Type, 0)).Val(diff).Call(1) // ptrdiff_t is signed
+				ctx.divSizeof(t1.Elem())
 				return
 			}
-			log.Panicln("binaryOp token.ADD/SUB - TODO: unexpected")
+			panicln(ErrNotImpl, "binaryOp token.ADD/SUB - TODO: unexpected")
 		}
 	}
-	if !isShiftOpertor(op) {
+	if isShiftOpertor(op) {
+		shiftCount(ctx, arg1.Type, arg2)
+	} else {
 		isUnt1 := isUntyped(arg1.Type)
 		isUnt2 := isUntyped(arg2.Type)
 		if isUnt1 && !isUnt2 {
@@ -436,14 +602,20 @@ func castPtrOrFnPtrType(cb *gox.CodeBuilder, kind int, from, to types.Type, v *g
 
 func stringLit(cb *gox.CodeBuilder, s string, typ types.Type) {
 	n := len(s)
-	eos := true
+	eos, signed := true, true
 	if typ == nil {
 		typ = types.NewArray(types.Typ[types.Int8], int64(n+1))
 	} else if t, ok := typ.(*types.Array); ok {
-		eos = int(t.Len()) > n
+		eos, signed = int(t.Len()) > n, t.Elem() == types.Typ[types.Int8]
 	}
 	for i := 0; i < n; i++ {
-		cb.Val(rune(s[i]))
+		if c := s[i]; c < 0x80 {
+			cb.Val(rune(c))
+		} else if signed { // eg. UTF-8 encoded
+			cb.Val(int(int8(c)))
+		} else {
+			cb.Val(int(c))
+		}
 	}
 	if eos {
 		cb.Val(rune(0)).ArrayLit(typ, n+1)
@@ -452,6 +624,23 @@ func stringLit(cb *gox.CodeBuilder, s string, typ types.Type) {
 	}
 }
 
+func wstringLit(cb *gox.CodeBuilder, s []rune, typ types.Type) {
+	n := len(s)
+	eos := int(typ.(*types.Array).Len()) > n
+	for _, c := range s {
+		if utf8.ValidRune(c) {
+			cb.Val(c)
+		} else { // eg. UTF-16 surrogates
+			cb.Val(int(c))
+		}
+	}
+	if eos {
+		cb.Val(0).ArrayLit(typ, n+1)
+	} else {
+		cb.ArrayLit(typ, n)
+	}
+}
+
 func arrayToElemPtr(cb *gox.CodeBuilder) {
 	arr := cb.InternalStack().Pop()
 	t, _ := gox.DerefType(arr.Type)
@@ -466,20 +655,23 @@ func castToBoolExpr(cb *gox.CodeBuilder) {
 		cb.Val(0).BinaryOp(token.NEQ)
 	} else if isNilComparable(t) {
 		cb.Val(nil).BinaryOp(token.NEQ)
+	} else if is128(t) {
+		cb.StructLit(t, 0, false).BinaryOp(token.NEQ)
 	}
 }
 
-func valOfAddr(cb *gox.CodeBuilder, addr types.Object, ctx *blockCtx) (elemSize int) {
+// valOfAddr pushes addr, and returns type of elements if *addr is a pointer.
+func valOfAddr(cb *gox.CodeBuilder, addr types.Object, ctx *blockCtx) (elem types.Type) {
 	typ := addr.Type()
 	if t, ok := typ.(*types.Pointer); ok {
 		typ = t.Elem()
 		if t, ok = typ.(*types.Pointer); ok { // **type
 			castPtrType(cb, tyUintptrPtr, addr)
-			return ctx.sizeof(t.Elem())
+			return t.Elem()
 		}
 	}
 	cb.Val(addr)
-	return 1
+	return nil
 }
 
 func isBasicLit(v *gox.Element) (ok bool) {
@@ -511,7 +703,7 @@ func adjustIntConst(ctx *blockCtx, v *gox.Element, typ types.Type) {
 	if e := v.CVal; e == nil || e.Kind() != constant.Int {
 		return
 	}
-	if t, ok := typ.(*types.Basic); ok && isNormalInteger(t) { // integer
+	if t, ok := typ.Underlying().(*types.Basic); ok && isNormalInteger(t) { // integer
 		adjustBigIntConst(ctx, v, t)
 	}
 }
@@ -540,12 +732,17 @@ func typeCastCall(ctx *blockCtx, typ types.Type) {
 	cb := ctx.cb
 	stk := cb.InternalStack()
 	v := stk.Get(-1)
+	if (is128(typ) || is128(v.Type)) && !ctypes.Identical(typ, v.Type) {
+		stk.PopN(2)
+		cast128(ctx, typ, v)
+		return
+	}
 	if convertibleTo(v.Type, typ) {
 		adjustIntConst(ctx, v, typ)
 		cb.Call(1)
 		return
 	}
-	switch vt := v.Type.(type) {
+	switch vt := v.Type.Underlying().(type) {
 	case *types.Pointer:
 		stk.Pop()
 		if _, ok := typ.(*types.Pointer); ok || typ == tyUintptr { // ptr => ptr|uintptr
@@ -554,7 +751,7 @@ func typeCastCall(ctx *blockCtx, typ types.Type) {
 			castPtrType(cb, tyUintptr, v)
 		}
 	case *types.Basic:
-		switch tt := typ.(type) {
+		switch tt := typ.Underlying().(type) {
 		case *types.Pointer:
 			stk.Pop()
 			adjustIntConst(ctx, v, tyUintptr)
@@ -593,7 +790,7 @@ func typeCastCall(ctx *blockCtx, typ types.Type) {
 func typeCastIndex(ctx *blockCtx, lhs bool) {
 	cb := ctx.cb
 	v := cb.Get(-2)
-	switch v.Type.(type) {
+	switch v.Type.Underlying().(type) {
 	case *types.Pointer, *types.Basic: // p[n] = *(p+n), n[p] = *(n+p)
 		binaryOp(ctx, token.ADD, &cast.Node{})
 		if lhs {
@@ -1,12 +1,20 @@
 package cl
 
 import (
+	"bytes"
+	"fmt"
+	"go/constant"
+	"go/format"
 	"go/token"
 	"go/types"
+	"io"
 	"log"
+	"strconv"
+	"strings"
 	"syscall"
 
 	goast "go/ast"
+	goparser "go/parser"
 
 	"github.com/goplus/gox"
 	"github.com/goplus/gox/cpackages"
@@ -101,8 +109,11 @@ func (p *nodeInterp) LoadExpr(v goast.Node) (code string, pos token.Position) {
 // -----------------------------------------------------------------------------
 
 type PkgInfo struct {
-	typdecls map[string]*gox.TypeDecl
-	extfns   map[string]none // external functions which are used
+	typdecls    map[string]*gox.TypeDecl
+	extfns      map[string]none       // external functions which are used
+	aligns      map[*types.Named]int  // records whose alignment in C is greater than in Go
+	records     map[string]*Record    // records to check layouts, keyed by Go names
+	alignedVars map[types.Object]none // over-aligned variables
 }
 
 type Package struct {
@@ -115,6 +126,54 @@ func (p Package) IsValid() bool {
 	return p.Package != nil
 }
 
+// WriteTo writes a file named fname to dst.
+// If fname is not provided, it writes the default (NOT current) file.
+//
+// Unlike gox, it doesn't import packages which are only referenced by function
+// bodies rolled back in keep-going mode (see compileFuncBody): gox keeps an
+// import once any expression referenced it.
+func (p Package) WriteTo(dst io.Writer, fname ...string) error {
+	var b bytes.Buffer
+	if err := p.Package.WriteTo(&b, fname...); err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", b.Bytes(), goparser.ParseComments)
+	if err != nil || !removeUnusedImports(f) {
+		_, err = dst.Write(b.Bytes())
+		return err
+	}
+	return format.Node(dst, fset, f)
+}
+
+func removeUnusedImports(f *goast.File) (removed bool) {
+	used := make(map[string]none)
+	goast.Inspect(f, func(n goast.Node) bool {
+		if sel, ok := n.(*goast.SelectorExpr); ok {
+			if x, ok := sel.X.(*goast.Ident); ok {
+				used[x.Name] = none{}
+			}
+		}
+		return true
+	})
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*goast.GenDecl); ok && d.Tok == token.IMPORT {
+			specs := d.Specs[:0]
+			for _, spec := range d.Specs {
+				if name := spec.(*goast.ImportSpec).Name; name != nil && name.Name != "_" && name.Name != "." {
+					if _, ok := used[name.Name]; !ok {
+						removed = true
+						continue
+					}
+				}
+				specs = append(specs, spec)
+			}
+			d.Specs = specs
+		}
+	}
+	return
+}
+
 type Reused struct {
 	pkg    Package
 	exists map[string]none
@@ -154,6 +213,10 @@ type Config struct {
 	// If ProcDepPkg is nil, it means nothing to do.
 	ProcDepPkg func(depPkgDir string)
 
+	// DepOutDir specifies where generated files (c2go.a.pub, etc.) of a
+	// dependent package are. If DepOutDir is nil, they are in depPkgDir.
+	DepOutDir func(depPkgDir string) string
+
 	// Deps specifies all dependent packages for the target Go package.
 	Deps []string
 
@@ -169,8 +232,28 @@ type Config struct {
 	// NeedPkgInfo allows to check dependencies and write them to c2go_autogen.go file.
 	NeedPkgInfo bool
 
+	// NeedRecords allows to get records by Package.Records, and write a test
+	// of their layouts by Package.WriteLayoutTestTo.
+	NeedRecords bool
+
 	// TestMain specifies to generate TestMain func as entry, not main func.
 	TestMain bool
+
+	// KeepGoing specifies to replace bodies of functions which can't be translated
+	// with a panic stub, instead of failing. NewPackage still returns a valid
+	// package in this case, and err is an ErrorList of SevWarning diagnostics.
+	KeepGoing bool
+
+	// Target specifies the data model of the target which C files are compiled
+	// for. It decides types of long and char, and results of sizeof/offsetof.
+	// If Target is nil, it's the host (ctypes.Host).
+	Target *ctypes.Target
+
+	// ArchNeutral specifies to generate Go code which works on all platforms:
+	// long and unsigned long are translated into clang.Long and clang.Ulong,
+	// and sizeof/offsetof whose results depend on the platform are translated
+	// into unsafe.Sizeof/unsafe.Offsetof, rather than constants of Target.
+	ArchNeutral bool
 }
 
 const (
@@ -180,6 +263,7 @@ const (
 // NewPackage create a Go package from C file AST.
 // If conf.Reused isn't nil, it shares the Go package instance in multi C files.
 // Otherwise it creates a single Go file in the Go package.
+// If translation fails, err is an ErrorList which describes the failures.
 func NewPackage(pkgPath, pkgName string, file *ast.Node, conf *Config) (pkg Package, err error) {
 	if reused := conf.Reused; reused != nil && reused.pkg.Package != nil {
 		pkg = reused.pkg
@@ -204,7 +288,7 @@ func NewPackage(pkgPath, pkgName string, file *ast.Node, conf *Config) (pkg Pack
 }
 
 func implicitCast(pkg *gox.Package, V, T types.Type, pv *gox.Element) bool {
-	switch t := T.(type) {
+	switch t := T.Underlying().(type) {
 	case *types.Basic:
 		/* TODO:
 		if vt.Kind() == types.UntypedInt {
@@ -222,7 +306,7 @@ func implicitCast(pkg *gox.Package, V, T types.Type, pv *gox.Element) bool {
 				pv.Type, pv.Val = T, e.Val
 				return true
 			}
-			if v, ok := V.(*types.Basic); ok && (v.Info()&types.IsInteger) != 0 { // int => int
+			if v, ok := V.Underlying().(*types.Basic); ok && (v.Info()&types.IsInteger) != 0 { // int => int
 				e := pkg.CB().Typ(T).Val(pv).Call(1).InternalStack().Pop()
 				pv.Type, pv.Val = T, e.Val
 				return true
@@ -231,7 +315,7 @@ func implicitCast(pkg *gox.Package, V, T types.Type, pv *gox.Element) bool {
 	case *types.Pointer:
 		return false
 	}
-	log.Panicln("==> implicitCast:", V, "to:", T)
+	panicln(ErrNotImpl, "TODO: implicitCast", V, "to:", T)
 	return false
 }
 
@@ -243,20 +327,32 @@ func loadFile(p *gox.Package, conf *Config, file *ast.Node) (pi *PkgInfo, err er
 	}
 	ctx := &blockCtx{
 		pkg: p, cb: p.CB(), fset: p.Fset,
-		unnameds: make(map[ast.ID]unnamedType),
-		gblvars:  make(map[string]*gox.VarDefs),
-		ignored:  conf.Ignored,
-		public:   conf.Public,
-		srcfile:  conf.SrcFile,
-		src:      conf.Src,
-		testMain: conf.TestMain,
+		unnameds:  make(map[ast.ID]unnamedType),
+		gblvars:   make(map[string]*gox.VarDefs),
+		ignored:   conf.Ignored,
+		public:    conf.Public,
+		srcfile:   conf.SrcFile,
+		src:       conf.Src,
+		testMain:  conf.TestMain,
+		keepGoing: conf.KeepGoing,
+
+		archNeutral: conf.ArchNeutral,
 	}
+	ctx.initTarget(conf.Target)
+	defer func() {
+		if e := recover(); e != nil {
+			ctx.recoverDiag(e)
+		}
+		if len(ctx.diags) > 0 {
+			err = ctx.diags
+		}
+	}()
 	ctx.initMultiFileCtl(p, conf)
 	ctx.initCTypes()
 	ctx.initFile()
 	ctx.initPublicFrom(conf, file)
 	compileDeclStmt(ctx, file, true)
-	if conf.NeedPkgInfo {
+	if conf.NeedPkgInfo || conf.NeedRecords {
 		pkgInfo := ctx.PkgInfo // make a copy: don't keep a ref to blockCtx
 		pi = &pkgInfo
 	}
@@ -265,6 +361,7 @@ func loadFile(p *gox.Package, conf *Config, file *ast.Node) (pi *PkgInfo, err er
 
 func compileDeclStmt(ctx *blockCtx, node *ast.Node, global bool) {
 	scope := ctx.cb.Scope()
+	old := ctx.curnode
 	n := len(node.Inner)
 	for i := 0; i < n; i++ {
 		decl := node.Inner[i]
@@ -274,6 +371,7 @@ func compileDeclStmt(ctx *blockCtx, node *ast.Node, global bool) {
 				continue
 			}
 		}
+		ctx.curnode = decl
 		switch decl.Kind {
 		case ast.VarDecl:
 			compileVarDecl(ctx, decl, global)
@@ -309,6 +407,8 @@ func compileDeclStmt(ctx *blockCtx, node *ast.Node, global bool) {
 		case ast.EnumDecl:
 			compileEnum(ctx, decl, global)
 		case ast.EmptyDecl:
+		case ast.StaticAssertDecl:
+			compileStaticAssert(ctx, decl)
 		case ast.FunctionDecl:
 			if global {
 				compileFunc(ctx, decl)
@@ -316,9 +416,39 @@ func compileDeclStmt(ctx *blockCtx, node *ast.Node, global bool) {
 			}
 			fallthrough
 		default:
-			log.Panicln("compileDeclStmt: unknown kind =", decl.Kind)
+			panicln(ErrUnknownKind, "compileDeclStmt: unknown kind =", decl.Kind)
 		}
 	}
+	ctx.curnode = old
+}
+
+// compileStaticAssert checks a _Static_assert again in Go. Clang has checked it
+// holds in C, so if it fails with sizeof, offsetof, etc. of the translated Go
+// types, they don't have the same layouts as C. It isn't checked if it isn't a
+// constant in Go.
+func compileStaticAssert(ctx *blockCtx, decl *ast.Node) {
+	cb := ctx.cb
+	compileExpr(ctx, decl.Inner[0])
+	castToBoolExpr(cb)
+	cond := cb.InternalStack().Pop()
+	if cond.CVal == nil || cond.CVal.Kind() != constant.Bool || constant.BoolVal(cond.CVal) {
+		return
+	}
+	msg := "static assertion failed in Go"
+	if len(decl.Inner) > 1 {
+		msg += ": " + staticAssertMsg(decl.Inner[1])
+	}
+	panicln(ErrLayout, msg)
+}
+
+// staticAssertMsg unquotes the message of a _Static_assert. It returns the C
+// literal as it is if it can't be unquoted in Go (eg. with C-only escapes).
+func staticAssertMsg(lit *ast.Node) string {
+	val := lit.Value.(string)
+	if s, err := strconv.Unquote(val[strings.IndexByte(val, '"'):]); err == nil {
+		return s
+	}
+	return val
 }
 
 func compileFunc(ctx *blockCtx, fn *ast.Node) {
@@ -347,7 +477,7 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 			ast.NonNullAttr, ast.ConstAttr, ast.PureAttr, ast.GNUInlineAttr, ast.ReturnsTwiceAttr, ast.NoSanitizeAttr,
 			ast.RestrictAttr, ast.MSAllocatorAttr, ast.VisibilityAttr, ast.C11NoReturnAttr:
 		default:
-			log.Panicln("compileFunc: unknown kind =", item.Kind)
+			panicln(ErrUnknownKind, "compileFunc: unknown kind =", item.Kind)
 		}
 	}
 	variadic := fn.Variadic
@@ -376,14 +506,9 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 		}
 		f, err := pkg.NewFuncWith(ctx.goNodePos(fn), fnName, sig, nil)
 		if err != nil {
-			log.Panicln("compileFunc:", err)
+			panicln(ErrCodeGen, "compileFunc:", err)
 		}
-		cb := f.BodyStart(pkg)
-		ctx.curfn = newFuncCtx(pkg, ctx.markComplicated(fnName, body))
-		compileSub(ctx, body)
-		checkNeedReturn(ctx, body)
-		ctx.curfn = nil
-		cb.End()
+		compileFuncBody(ctx, f, fn, fnName, body)
 		if isMain {
 			var t *types.Var
 			var entryParams *types.Tuple
@@ -395,7 +520,7 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 				t = pkg.NewParam(token.NoPos, "t", types.NewPointer(testing.Ref("T").Type()))
 				entryParams = types.NewTuple(t)
 			}
-			pkg.NewFunc(nil, entry, entryParams, nil, false).BodyStart(pkg)
+			cb := pkg.NewFunc(nil, entry, entryParams, nil, false).BodyStart(pkg)
 			if results != nil {
 				if testMain {
 					// if _cgo_ret := _cgo_main(); _cgo_ret != 0 {
@@ -408,9 +533,7 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 				}
 			}
 			cb.Val(f.Func)
-			if params != nil {
-				panic("TODO: main func with params")
-			}
+			mainArgs(ctx, params)
 			cb.Call(len(params))
 			if results != nil {
 				if testMain {
@@ -427,7 +550,7 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 		} else {
 			delete(ctx.extfns, fnName)
 		}
-	} else if fn.IsUsed {
+	} else if fn.IsUsed && jmpKindOfName(fnName) == jmpNone {
 		f := types.NewFunc(ctx.goNodePos(fn), pkg.Types, fnName, sig)
 		if pkg.Types.Scope().Insert(f) == nil {
 			ctx.addExternFunc(fnName)
@@ -439,6 +562,94 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 	}
 }
 
+// clang.CStrings(strs []string) **int8
+var cstringsFn = func() *types.Func {
+	params := types.NewTuple(types.NewParam(token.NoPos, clangPkg, "strs", types.NewSlice(types.Typ[types.String])))
+	results := types.NewTuple(types.NewParam(token.NoPos, clangPkg, "", types.NewPointer(types.NewPointer(types.Typ[types.Int8]))))
+	fn := types.NewFunc(token.NoPos, clangPkg, "CStrings", types.NewSignature(nil, params, results, false))
+	clangPkg.Scope().Insert(fn)
+	return fn
+}()
+
+// mainArgs pushes arguments of main(argc, argv, envp), that is, int32(len(os.Args)),
+// clang.CStrings(os.Args) and clang.CStrings(os.Environ()).
+func mainArgs(ctx *blockCtx, params []*types.Var) {
+	if len(params) > 3 {
+		panicln(ErrNotImpl, "main func with", len(params), "params")
+	}
+	cb := ctx.cb
+	osPkg := ctx.pkg.Import("os")
+	for i, param := range params {
+		typ := param.Type()
+		switch i {
+		case 0: // argc
+			cb.Typ(typ).Val(ctx.pkg.Builtin().Ref("len")).Val(osPkg.Ref("Args")).Call(1).Call(1)
+			continue
+		case 1: // argv
+			cb.Val(cstringsFn).Val(osPkg.Ref("Args")).Call(1)
+		case 2: // envp
+			cb.Val(cstringsFn).Val(osPkg.Ref("Environ")).Call(0).Call(1)
+		}
+		if arg := cb.Get(-1); !ctypes.Identical(typ, arg.Type) {
+			castPtrType(cb, typ, cb.InternalStack().Pop())
+		}
+	}
+}
+
+func compileFuncBody(ctx *blockCtx, f *gox.Func, fn *ast.Node, fnName string, body *ast.Node) {
+	if ctx.keepGoing {
+		defer rollbackFuncBody(ctx, f, *ctx.cb, ctx.curflow)
+	}
+	pkg := ctx.pkg
+	cb := f.BodyStart(pkg)
+	marker := ctx.markFuncBody(fnName, body)
+	ctx.curfn = newFuncCtx(pkg, marker.complicat || marker.npoint > 0)
+	if marker.addrs != nil {
+		newLabelAddrs(ctx, fnName, marker.addrs)
+	}
+	for _, item := range fn.Inner {
+		if item.Kind == ast.ParmVarDecl && item.Name != "" { // pointers to VLA
+			newVLAPtr(ctx, cb.Scope(), item)
+		}
+	}
+	if marker.npoint > 0 {
+		compileSetjmpFuncBody(ctx, body, marker.setjmps, marker.npoint)
+	} else {
+		compileSub(ctx, body)
+		checkNeedReturn(ctx, body)
+	}
+	ctx.curfn = nil
+	cb.End()
+}
+
+// rollbackFuncBody recovers from failure of compiling a function body, restores
+// states of CodeBuilder (cb) and blockCtx before the body started, and stubs the
+// body out. Imports only referenced by the failed body can't be dropped in gox,
+// and are removed when writing files (see Package.WriteTo).
+func rollbackFuncBody(ctx *blockCtx, f *gox.Func, cb gox.CodeBuilder, flow flowCtx) {
+	if e := recover(); e != nil {
+		*ctx.cb = cb
+		ctx.curfn, ctx.curflow = nil, flow
+		stubFuncBody(ctx, f, e)
+	}
+}
+
+// stubFuncBody records why a function body can't be translated, and replaces
+// it with: panic("c2go: unsupported <construct> at <file>:<line>")
+func stubFuncBody(ctx *blockCtx, f *gox.Func, e interface{}) {
+	d := ctx.recoverDiag(e)
+	d.Severity = SevWarning
+	what := string(d.Kind)
+	if what == "" {
+		what = string(d.Code)
+	}
+	msg := fmt.Sprintf("c2go: unsupported %s at %s:%d", what, d.File, d.Line)
+	pkg := ctx.pkg
+	f.BodyStart(pkg).
+		Val(types.Universe.Lookup("panic")).Val(msg).Call(1).EndStmt().
+		End()
+}
+
 func (p *blockCtx) getPubName(pfnName *string) (ok bool) {
 	name := *pfnName
 	goName, ok := p.public[name]
@@ -484,7 +695,7 @@ func compileVAArgExpr(ctx *blockCtx, expr *ast.Node) {
 			Val(args).Val(0).IndexRef(1).UnaryOp(token.AND).
 			Call(1).Call(1).Val(1).Index(1, false).
 			Call(1).Assign(1)
-	} else if t, ok := typ.(*types.Basic); ok && isNormalInteger(t) {
+	} else if t, ok := typ.Underlying().(*types.Basic); ok && isNormalInteger(t) {
 		// switch _cgo_tag := __cgo_args[0].(type) {
 		// case typ:
 		//   _go_ret = _cgo_tag
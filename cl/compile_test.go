@@ -3,14 +3,18 @@ package cl
 import (
 	"bytes"
 	"go/format"
+	"go/importer"
 	"go/token"
+	"go/types"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 
 	goast "go/ast"
+	goparser "go/parser"
 
 	"github.com/goplus/gox"
 	"github.com/weblfe/c2go/clang/ast"
@@ -93,6 +97,7 @@ func newTestEnv(code string) *testEnv {
 		unnameds: make(map[ast.ID]unnamedType),
 	}
 	ctx.typdecls = make(map[string]*gox.TypeDecl)
+	ctx.initTarget(nil)
 	ctx.initCTypes()
 	return &testEnv{doc: doc, pkg: p, ctx: ctx, json: json}
 }
@@ -164,6 +169,93 @@ void test(int var) {
 }`)
 }
 
+func TestKeepGoing(t *testing.T) {
+	doc, src := parse(`
+float imag(_Complex float z) {
+	return __imag__ z;
+}
+
+int add(int a, int b) {
+	return a + b;
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, KeepGoing: true})
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 || errs.HasError() || errs[0].Code != ErrUnknownOp {
+		t.Fatal("NewPackage:", err)
+	}
+	file := gox.ASTFile(pkg.Package)
+	w := bytes.NewBuffer(nil)
+	format.Node(w, pkg.Fset, findFunc(file, "imag"))
+	if out := w.String(); !strings.Contains(out, `panic("c2go: unsupported UnaryOperator at `) {
+		t.Fatal("imag:", out)
+	}
+	if findFunc(file, "add") == nil {
+		t.Fatal("add not found")
+	}
+}
+
+// TestKeepGoingNested checks that a function body which fails deep inside
+// nested blocks is rolled back, and the next function compiles as usual.
+func TestKeepGoingNested(t *testing.T) {
+	param := func(name, typ string) *ast.Node {
+		v := newTestNode(ast.ParmVarDecl, typ)
+		v.Name = name
+		return v
+	}
+	// void f(int *p, int n) {
+	//	if (n) { while (n) { { p = p + 1; <unknown expr>; } } }
+	// }
+	// int g(int a) { return a + 1; }
+	inc := newTestNode(ast.BinaryOperator, "int *", testRValue("p", "int *"), testIntLit("long", "1"))
+	inc.OpCode = "+"
+	p := newTestNode(ast.DeclRefExpr, "int *")
+	p.ReferencedDecl = &ast.Node{Name: "p", Kind: ast.ParmVarDecl}
+	assign := newTestNode(ast.BinaryOperator, "int *", p, inc)
+	assign.OpCode = "="
+	block := newTestNode(ast.CompoundStmt, "", assign, newTestNode("UnknownExpr", "int"))
+	loop := newTestNode(ast.WhileStmt, "", testRValue("n", "int"), newTestNode(ast.CompoundStmt, "", block))
+	ifStmt := newTestNode(ast.IfStmt, "", testRValue("n", "int"), newTestNode(ast.CompoundStmt, "", loop))
+	f := newTestNode(ast.FunctionDecl, "void (int *, int)",
+		param("p", "int *"), param("n", "int"), newTestNode(ast.CompoundStmt, "", ifStmt))
+	f.Name = "f"
+	sum := newTestNode(ast.BinaryOperator, "int", testRValue("a", "int"), testIntLit("int", "1"))
+	sum.OpCode = "+"
+	g := newTestNode(ast.FunctionDecl, "int (int)",
+		param("a", "int"), newTestNode(ast.CompoundStmt, "", newTestNode(ast.ReturnStmt, "", sum)))
+	g.Name = "g"
+	doc := newTestNode(ast.TranslationUnitDecl, "", f, g)
+
+	pkg, err := NewPackage("", "foo", doc, &Config{Src: []byte(" "), KeepGoing: true})
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 || errs.HasError() || errs[0].Code != ErrUnknownKind {
+		t.Fatal("NewPackage:", err)
+	}
+	var b bytes.Buffer
+	if err = pkg.WriteTo(&b); err != nil {
+		t.Fatal("WriteTo:", err)
+	}
+	out := b.String()
+	if !strings.HasSuffix(out, `func f(p *int32, n int32) {
+	panic("c2go: unsupported UnknownExpr at :1")
+}
+func g(a int32) int32 {
+	return a + int32(1)
+}
+`) {
+		t.Fatal("WriteTo:", out)
+	}
+	fset := token.NewFileSet()
+	file, err := goparser.ParseFile(fset, "foo.go", out, 0)
+	if err != nil {
+		t.Fatal("ParseFile:", err)
+	}
+	conf := &types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err = conf.Check("foo", fset, []*goast.File{file}, nil); err != nil {
+		t.Fatalf("Check: %v\n%s", err, out)
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 func TestNodeInterp(t *testing.T) {
@@ -0,0 +1,243 @@
+package cl
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/gox"
+	"github.com/weblfe/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+// Severity represents how serious a Diagnostic is.
+type Severity int
+
+const (
+	SevError Severity = iota
+	SevWarning
+)
+
+func (p Severity) String() string {
+	if p == SevWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// ErrCode is a stable code to classify diagnostics.
+type ErrCode string
+
+const (
+	ErrInternal    ErrCode = "internal"     // unclassified failure
+	ErrUnknownKind ErrCode = "unknown-kind" // unsupported kind of AST node
+	ErrUnknownOp   ErrCode = "unknown-op"   // unsupported operator
+	ErrUnknownCast ErrCode = "unknown-cast" // unsupported cast kind
+	ErrInvalidType ErrCode = "invalid-type" // C type can't be converted to a Go type
+	ErrNotImpl     ErrCode = "not-impl"     // C syntax which isn't implemented yet
+	ErrCodeGen     ErrCode = "codegen"      // error reported when generating Go code
+	ErrLayout      ErrCode = "layout"       // Go layout of a C type doesn't match C
+)
+
+// Diagnostic represents a translation failure of a C source file.
+type Diagnostic struct {
+	File     string   // C source file
+	Line     int      // line number, starting at 1
+	Column   int      // column number, starting at 1 (byte count)
+	Kind     ast.Kind // kind of the AST node being compiled
+	Severity Severity
+	Code     ErrCode
+	Msg      string
+}
+
+func (p *Diagnostic) Error() string {
+	var b strings.Builder
+	if p.File != "" {
+		b.WriteString(p.File)
+		if p.Line > 0 {
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(p.Line))
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(p.Column))
+		}
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "%v: %s [%s", p.Severity, p.Msg, p.Code)
+	if p.Kind != "" {
+		b.WriteString(", ")
+		b.WriteString(string(p.Kind))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// ErrorList is a list of diagnostics. It's returned by NewPackage as an error.
+type ErrorList []*Diagnostic
+
+func (p ErrorList) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	msgs := make([]string, len(p))
+	for i, e := range p {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// HasError reports whether p contains any diagnostic of SevError severity.
+func (p ErrorList) HasError() bool {
+	for _, e := range p {
+		if e.Severity == SevError {
+			return true
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+
+// panicln aborts compiling current node with a classified error.
+func panicln(code ErrCode, args ...interface{}) {
+	msg := fmt.Sprintln(args...)
+	panic(&Diagnostic{Code: code, Msg: msg[:len(msg)-1]})
+}
+
+// enter sets v as the node being compiled, and returns the old one. Note that
+// the old node isn't restored when a panic occurs, so curnode always points to
+// the innermost node which fails.
+func (p *blockCtx) enter(v *ast.Node) (old *ast.Node) {
+	old, p.curnode = p.curnode, v
+	return
+}
+
+func (p *blockCtx) newDiagnostic(e interface{}) *Diagnostic {
+	var d *Diagnostic
+	switch v := e.(type) {
+	case *Diagnostic:
+		d = v
+	case *gox.CodeError:
+		d = &Diagnostic{Code: ErrCodeGen, Msg: v.Msg}
+	case error:
+		d = &Diagnostic{Code: ErrInternal, Msg: v.Error()}
+	default:
+		d = &Diagnostic{Code: ErrInternal, Msg: strings.TrimSuffix(fmt.Sprint(v), "\n")}
+	}
+	d.File = p.srcfile
+	if v := p.curnode; v != nil {
+		if d.Kind == "" {
+			d.Kind = v.Kind
+		}
+		if off, ok := nodeOffset(v); ok {
+			d.File, d.Line, d.Column = p.srcPos(off)
+		}
+	}
+	return d
+}
+
+func (p *blockCtx) recoverDiag(e interface{}) *Diagnostic {
+	if debugCompileDecl {
+		log.Printf("%v\n%s", e, debug.Stack())
+	}
+	d := p.newDiagnostic(e)
+	p.diags = append(p.diags, d)
+	return d
+}
+
+func nodeOffset(v *ast.Node) (int64, bool) {
+	if rg := v.Range; rg != nil {
+		if loc := rg.Begin.ExpansionLoc; loc != nil {
+			return loc.Offset, true
+		}
+		return rg.Begin.Offset, true
+	}
+	if loc := v.Loc; loc != nil {
+		return loc.Offset, true
+	}
+	return 0, false
+}
+
+// -----------------------------------------------------------------------------
+
+type lineMarker struct {
+	off  int // offset of the line after this marker
+	file string
+	line int
+}
+
+// srcPos converts an offset of the preprocessed file into a position of the C
+// source file, by using line markers (# line "file") in the preprocessed file.
+func (p *blockCtx) srcPos(offset int64) (file string, line, col int) {
+	src := p.src
+	off := int(offset)
+	if off < 0 || off > len(src) {
+		return p.srcfile, 0, 0
+	}
+	if p.markers == nil {
+		p.markers = lineMarkers(src)
+	}
+	markers := p.markers
+	i := sort.Search(len(markers), func(i int) bool {
+		return markers[i].off > off
+	})
+	from := 0
+	file, line = p.srcfile, 1
+	if i > 0 {
+		m := markers[i-1]
+		from, file, line = m.off, m.file, m.line
+	}
+	line += bytes.Count(src[from:off], []byte{'\n'})
+	col = off - (bytes.LastIndexByte(src[:off], '\n') + 1) + 1
+	return
+}
+
+func lineMarkers(src []byte) []lineMarker {
+	markers := make([]lineMarker, 0, 16)
+	for off := 0; off < len(src); {
+		end := bytes.IndexByte(src[off:], '\n')
+		if end < 0 {
+			end = len(src)
+		} else {
+			end += off
+		}
+		if m, ok := parseLineMarker(src[off:end]); ok {
+			m.off = end + 1
+			markers = append(markers, m)
+		}
+		off = end + 1
+	}
+	return markers
+}
+
+// parseLineMarker parses a line marker: # linenum "filename" flags
+func parseLineMarker(b []byte) (m lineMarker, ok bool) {
+	if len(b) < 2 || b[0] != '#' {
+		return
+	}
+	flds := strings.SplitN(strings.TrimLeft(string(b[1:]), space), " ", 2)
+	if len(flds) != 2 {
+		return
+	}
+	line, err := strconv.Atoi(flds[0])
+	if err != nil {
+		return
+	}
+	name := flds[1]
+	if pos := strings.LastIndexByte(name, '"'); pos > 0 {
+		name = name[:pos+1]
+	}
+	if name, err = strconv.Unquote(name); err != nil {
+		return
+	}
+	return lineMarker{file: name, line: line}, true
+}
+
+// -----------------------------------------------------------------------------
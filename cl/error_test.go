@@ -0,0 +1,90 @@
+package cl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weblfe/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+const markedSrc = `# 1 "foo.c"
+# 1 "<built-in>" 1
+# 1 "foo.c" 2
+# 1 "./foo.h" 1
+typedef int foo_t;
+# 2 "foo.c" 2
+
+int main() {
+	return x;
+}
+`
+
+func TestSrcPos(t *testing.T) {
+	ctx := &blockCtx{srcfile: "foo.c.i", src: []byte(markedSrc)}
+	cases := []struct {
+		code string
+		file string
+		line int
+		col  int
+	}{
+		{"typedef", "./foo.h", 1, 1},
+		{"int main", "foo.c", 3, 1},
+		{"x;", "foo.c", 4, 9},
+	}
+	for _, c := range cases {
+		off := strings.Index(markedSrc, c.code)
+		file, line, col := ctx.srcPos(int64(off))
+		if file != c.file || line != c.line || col != c.col {
+			t.Fatal("srcPos:", c.code, "-", file, line, col)
+		}
+	}
+	if file, line, _ := ctx.srcPos(-1); file != "foo.c.i" || line != 0 {
+		t.Fatal("srcPos(-1):", file, line)
+	}
+}
+
+func TestNewDiagnostic(t *testing.T) {
+	ctx := &blockCtx{srcfile: "foo.c.i", src: []byte(markedSrc)}
+	ctx.enter(&ast.Node{
+		Kind:  ast.ReturnStmt,
+		Range: &ast.Range{Begin: ast.Pos{Offset: int64(strings.Index(markedSrc, "return"))}},
+	})
+	func() {
+		defer func() {
+			ctx.recoverDiag(recover())
+		}()
+		panicln(ErrNotImpl, "TODO:", "return")
+	}()
+	if len(ctx.diags) != 1 {
+		t.Fatal("diags:", ctx.diags)
+	}
+	if msg := ctx.diags.Error(); msg != "foo.c:4:2: error: TODO: return [not-impl, ReturnStmt]" {
+		t.Fatal("Diagnostic.Error:", msg)
+	}
+	ctx.recoverDiag("compileExpr: unknown kind = Foo\n")
+	if d := ctx.diags[1]; d.Code != ErrInternal || d.Msg != "compileExpr: unknown kind = Foo" {
+		t.Fatal("recoverDiag:", d)
+	}
+	if msg := (ErrorList{}).Error(); msg != "no errors" {
+		t.Fatal("ErrorList.Error:", msg)
+	}
+}
+
+func TestDiagnosticCode(t *testing.T) {
+	// int x = y; where y can't be found in Go
+	x := newTestNode(ast.VarDecl, "int", testRValue("y", "int"))
+	x.Name, x.Init = "x", "c"
+	doc := newTestNode(ast.TranslationUnitDecl, "", x)
+	_, err := NewPackage("", "foo", doc, &Config{Src: []byte(" ")})
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 || errs[0].Code != ErrNotImpl {
+		t.Fatal("NewPackage:", err)
+	}
+	if msg := errs[0].Msg; msg != "compileDeclRefExpr: not found - y" {
+		t.Fatal("Diagnostic.Msg:", msg)
+	}
+}
+
+// -----------------------------------------------------------------------------
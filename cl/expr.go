@@ -6,6 +6,9 @@ import (
 	"go/types"
 	"log"
 	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	ctypes "github.com/weblfe/c2go/clang/types"
 
@@ -25,6 +28,7 @@ const (
 )
 
 func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
+	old := ctx.enter(expr)
 	switch expr.Kind {
 	case ast.BinaryOperator:
 		compileBinaryExpr(ctx, expr, flags)
@@ -50,6 +54,12 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 		compileLiteral(ctx, token.FLOAT, expr)
 	case ast.ParenExpr, ast.ConstantExpr:
 		compileExprEx(ctx, expr.Inner[0], prompt, flags)
+	case ast.GenericSelectionExpr:
+		compileExprEx(ctx, selectedExpr(expr), prompt, flags)
+	case ast.StmtExpr:
+		compileStmtExpr(ctx, expr, flags)
+	case ast.AddrLabelExpr:
+		compileAddrLabelExpr(ctx, expr)
 	case ast.CStyleCastExpr:
 		compileTypeCast(ctx, expr, ctx.goNode(expr))
 	case ast.ArraySubscriptExpr:
@@ -58,6 +68,8 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 		compileUnaryExprOrTypeTraitExpr(ctx, expr)
 	case ast.ImplicitValueInitExpr:
 		compileImplicitValueInitExpr(ctx, expr)
+	case ast.CompoundLiteralExpr:
+		compileCompoundLiteralExpr(ctx, expr)
 	case ast.ConditionalOperator:
 		compileConditionalOperator(ctx, expr)
 	case ast.ImaginaryLiteral:
@@ -70,8 +82,9 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 		compileOffsetOfExpr(ctx, expr)
 	case ast.VisibilityAttr:
 	default:
-		log.Panicln(prompt, expr.Kind)
+		panicln(ErrUnknownKind, prompt, expr.Kind)
 	}
+	ctx.curnode = old
 }
 
 func compileExpr(ctx *blockCtx, expr *ast.Node) {
@@ -84,6 +97,11 @@ func compileExprLHS(ctx *blockCtx, expr *ast.Node) {
 
 func compileIntegerLiteral(ctx *blockCtx, expr *ast.Node) {
 	typ := toType(ctx, expr.Type, 0)
+	if is128(typ) {
+		v := ctx.cb.Val(literal(token.INT, expr), ctx.goNode(expr)).InternalStack().Pop()
+		cast128(ctx, typ, v)
+		return
+	}
 	ctx.cb.Typ(typ).Val(literal(token.INT, expr), ctx.goNode(expr)).Call(1)
 }
 
@@ -92,15 +110,66 @@ func compileLiteral(ctx *blockCtx, kind token.Token, expr *ast.Node) {
 }
 
 func compileCharacterLiteral(ctx *blockCtx, expr *ast.Node) {
-	ctx.cb.Val(rune(expr.Value.(float64)), ctx.goNode(expr))
+	v := int64(expr.Value.(float64))
+	if typ := toType(ctx, expr.Type, 0); typ != ctypes.Int || !utf8.ValidRune(rune(v)) {
+		// L'c', u'c' and U'c' are typed, eg. uint16('c')
+		ctx.cb.Typ(typ).Val(int(v), ctx.goNode(expr)).Call(1)
+		return
+	}
+	ctx.cb.Val(rune(v), ctx.goNode(expr))
 }
 
 func compileStringLiteral(ctx *blockCtx, expr *ast.Node) {
-	s, err := strconv.Unquote(expr.Value.(string))
-	if err != nil {
-		log.Panicln("compileStringLiteral:", err)
+	stringLiteral(ctx, expr, nil)
+}
+
+// stringLiteral pushes an array of typ initialized by a string literal. If typ
+// is nil, it is the array type of the literal itself. A wide string literal
+// (L"...", u"..." or U"...") is an array of wchar_t, char16_t or char32_t, and
+// u8"..." is an array of char.
+func stringLiteral(ctx *blockCtx, lit *ast.Node, typ types.Type) {
+	val := lit.Value.(string)
+	prefix := strings.IndexByte(val, '"')
+	if isNarrowString(lit) {
+		s, err := strconv.Unquote(val[prefix:])
+		if err != nil {
+			panicln(ErrNotImpl, "stringLiteral:", err)
+		}
+		if typ == nil {
+			typ = types.NewArray(ctx.target.Char(), int64(len(s)+1))
+		}
+		stringLit(ctx.cb, s, typ)
+		return
+	}
+	if typ == nil {
+		typ = toType(ctx, lit.Type, 0)
+	}
+	elem := typ.(*types.Array).Elem()
+	wstringLit(ctx.cb, unquoteWide(val[prefix:], ctx.sizeof(elem) == 2), typ)
+}
+
+func isNarrowString(lit *ast.Node) bool {
+	val := lit.Value.(string)
+	return strings.HasPrefix(val, "\"") || strings.HasPrefix(val, "u8\"")
+}
+
+// unquoteWide unquotes a wide string literal into its code units.
+func unquoteWide(s string, isUTF16 bool) []rune {
+	var ret []rune
+	for s = s[1 : len(s)-1]; s != ""; {
+		c, _, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			panicln(ErrNotImpl, "unquoteWide:", err)
+		}
+		if isUTF16 && c > 0xffff {
+			r1, r2 := utf16.EncodeRune(c)
+			ret = append(ret, r1, r2)
+		} else {
+			ret = append(ret, c)
+		}
+		s = tail
 	}
-	stringLit(ctx.cb, s, nil)
+	return ret
 }
 
 func compileImaginaryLiteral(ctx *blockCtx, expr *ast.Node) {
@@ -123,20 +192,41 @@ func compileOffsetOfExpr(ctx *blockCtx, v *ast.Node) {
 		log.Println("==> offset", tyStruct, name)
 	}
 	t := toType(ctx, &ast.Type{QualType: tyStruct}, 0)
-	ctx.cb.Val(ctx.offsetof(t, name))
+	off := ctx.offsetof(t, name)
+	if ctx.isNeutralSize(t) && !ctx.isMisaligned(t, name) { // size_t(unsafe.Offsetof(T{}.name))
+		ctx.cb.Typ(toType(ctx, v.Type, 0))
+		ctx.unsafeOffsetof(t, name)
+		ctx.cb.Call(1)
+		return
+	}
+	ctx.cb.Val(off)
 }
 
 func compileSizeof(ctx *blockCtx, v *ast.Node) {
 	var t types.Type
 	if len(v.Inner) > 0 {
+		if vla, ok := vlaOf(ctx, v.Inner[0]); ok {
+			compileVLASizeof(ctx, vla, v)
+			return
+		}
 		compileExpr(ctx, v.Inner[0])
 		t = ctx.cb.InternalStack().Pop().Type
 	} else {
-		qualType := ctx.paramOfSizeof(v)
+		qualType := ctx.paramOfTypeTrait(v)
 		if debugCompileDecl {
 			log.Println("==> sizeof", qualType)
 		}
 		t = toType(ctx, &ast.Type{QualType: qualType}, 0)
+		if vla, ok := t.(*ctypes.VLA); ok {
+			compileVLASizeof(ctx, vla, v)
+			return
+		}
+	}
+	if ctx.isNeutralSize(t) { // size_t(unsafe.Sizeof(T{}))
+		ctx.cb.Typ(toType(ctx, v.Type, 0))
+		ctx.unsafeSizeof(t)
+		ctx.cb.Call(1)
+		return
 	}
 	ctx.cb.Val(ctx.sizeof(t))
 }
@@ -145,8 +235,12 @@ func compileUnaryExprOrTypeTraitExpr(ctx *blockCtx, v *ast.Node) {
 	switch v.Name {
 	case "sizeof":
 		compileSizeof(ctx, v)
+	case "alignof", "_Alignof":
+		compileAlignof(ctx, v, false)
+	case "__alignof", "__alignof__":
+		compileAlignof(ctx, v, true)
 	default:
-		log.Panicln("unaryExprOrTypeTraitExpr unknown:", v.Name)
+		panicln(ErrNotImpl, "unaryExprOrTypeTraitExpr unknown:", v.Name)
 	}
 }
 
@@ -155,7 +249,85 @@ func compileImplicitValueInitExpr(ctx *blockCtx, v *ast.Node) {
 	ctx.cb.ZeroLit(t)
 }
 
+// compileCompoundLiteralExpr compiles (T){...} into a Go composite literal T{...}.
+// A Go composite literal is addressable by &, and the object it refers to lives
+// as long as it is referenced, which covers both lifetimes of a C compound
+// literal (the enclosing block at block scope, and the whole program at file
+// scope).
+func compileCompoundLiteralExpr(ctx *blockCtx, v *ast.Node) {
+	typ := toType(ctx, v.Type, 0)
+	if _, ok := checkUnion(ctx, typ); ok {
+		panicln(ErrNotImpl, "compound literal of union: TODO")
+	}
+	initExpr := v.Inner[0]
+	if isCompositeLit(typ) {
+		varInit(ctx, typ, initExpr)
+	} else if initExpr.Kind != ast.InitListExpr { // (T){expr}
+		compileExpr(ctx, initExpr)
+	} else if len(initExpr.Inner) > 0 {
+		compileExpr(ctx, initExpr.Inner[0])
+	} else {
+		ctx.cb.ZeroLit(typ)
+	}
+}
+
+// compileCompoundLiteralAddr compiles &(T){...}. A scalar isn't addressable in
+// Go, so &(T){expr} is compiled into &[]T{expr}[0].
+func compileCompoundLiteralAddr(ctx *blockCtx, v *ast.Node) {
+	compileCompoundLiteralExpr(ctx, v)
+	cb := ctx.cb
+	if t := toType(ctx, v.Type, 0); !isCompositeLit(t) {
+		cb.SliceLit(types.NewSlice(t), 1).Val(0).Index(1, false)
+	}
+	cb.UnaryOp(token.AND)
+}
+
+func skipParen(v *ast.Node) *ast.Node {
+	for {
+		switch v.Kind {
+		case ast.ParenExpr:
+			v = v.Inner[0]
+		case ast.GenericSelectionExpr:
+			v = selectedExpr(v)
+		default:
+			return v
+		}
+	}
+}
+
+// selectedExpr returns the expression of the association which a _Generic
+// selection v selects. Clang has resolved it, so the controlling expression
+// and other associations are never compiled.
+func selectedExpr(v *ast.Node) *ast.Node {
+	for _, assoc := range v.Inner[1:] { // Inner[0] is the controlling expression
+		if assoc.Selected {
+			return assoc.Inner[len(assoc.Inner)-1] // type of the association comes first
+		}
+	}
+	panicln(ErrInternal, "_Generic: no association is selected")
+	return nil
+}
+
+func isCompositeType(typ types.Type) bool {
+	switch typ.Underlying().(type) {
+	case *types.Array, *types.Struct:
+		return true
+	}
+	return false
+}
+
+// isCompositeLit reports whether values of typ are Go composite literals, that
+// is typ is a struct or an array, except clang.Int128 and clang.Uint128 which
+// are scalars in C.
+func isCompositeLit(typ types.Type) bool {
+	return isCompositeType(typ) && !is128(typ)
+}
+
 func compileArraySubscriptExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
+	if vla, ok := vlaOf(ctx, v); ok { // a row of multi dimensional VLA
+		compileVLASubscript(ctx, vla, v)
+		return
+	}
 	compileExpr(ctx, v.Inner[0])
 	compileExpr(ctx, v.Inner[1])
 	typeCastIndex(ctx, lhs)
@@ -184,7 +356,13 @@ func compileImplicitCastExpr(ctx *blockCtx, v *ast.Node) {
 	case ast.FunctionToPointerDecay:
 		compileExpr(ctx, v.Inner[0])
 	case ast.ArrayToPointerDecay:
+		if compileFlexibleDecay(ctx, v.Inner[0]) {
+			break
+		}
 		compileExpr(ctx, v.Inner[0])
+		if _, ok := vlaOf(ctx, v.Inner[0]); ok { // VLA is already a pointer
+			break
+		}
 		if cb := ctx.cb; !isValist(cb.Get(-1).Type) {
 			arrayToElemPtr(cb)
 		}
@@ -195,7 +373,18 @@ func compileImplicitCastExpr(ctx *blockCtx, v *ast.Node) {
 	case ast.NullToPointer:
 		ctx.cb.Val(nil)
 	default:
-		log.Panicln("compileImplicitCastExpr: unknown castKind =", v.CastKind)
+		panicln(ErrUnknownCast, "compileImplicitCastExpr: unknown castKind =", v.CastKind)
+	}
+}
+
+// compileUnsafePointer compiles expr (a pointer) and converts it into
+// unsafe.Pointer.
+func compileUnsafePointer(ctx *blockCtx, expr *ast.Node) {
+	compileExpr(ctx, expr)
+	cb := ctx.cb
+	if arg := cb.Get(-1); arg.Type != ctypes.UnsafePointer {
+		arg = cb.InternalStack().Pop()
+		cb.Typ(ctypes.UnsafePointer).Val(arg).Call(1)
 	}
 }
 
@@ -227,7 +416,16 @@ func compileDeclRefExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
 	}
 	obj := ctx.lookupParent(name)
 	if obj == nil {
-		log.Panicln("compileDeclRefExpr: not found -", name)
+		panicln(ErrNotImpl, "compileDeclRefExpr: not found -", name)
+	}
+	if ctx.isAlignedVar(obj) { // x => *x
+		ctx.cb.Val(obj)
+		if lhs {
+			ctx.cb.ElemRef()
+		} else {
+			ctx.cb.Elem()
+		}
+		return
 	}
 	if lhs {
 		ctx.cb.VarRef(obj)
@@ -258,6 +456,14 @@ func compileCallExpr(ctx *blockCtx, v *ast.Node) {
 				return
 			}
 		}
+		switch jmpKindOf(v.Inner[0]) {
+		case jmpSetjmp:
+			compileSetjmp(ctx, v)
+			return
+		case jmpLongjmp:
+			compileLongjmp(ctx, v)
+			return
+		}
 		for i := 0; i < n; i++ {
 			compileExpr(ctx, v.Inner[i])
 		}
@@ -329,10 +535,68 @@ func compileCommaExpr(ctx *blockCtx, v *ast.Node, flags int) {
 	cb.Return(1).End().Call(0)
 }
 
+// compileStmtExpr compiles a statement expression ({ ...; expr; }), whose value
+// is the value of its last expression statement. It is translated into a block
+// if the value is unused (or void), or else into a closure returning the value.
+func compileStmtExpr(ctx *blockCtx, v *ast.Node, flags int) {
+	body := v.Inner[0]
+	t := toType(ctx, v.Type, 0)
+	if (flags&flagIgnoreResult) != 0 || t == ctypes.Void {
+		compileCompoundStmt(ctx, body)
+		return
+	}
+	checkStmtExprJumps(body, false, false)
+	src := ctx.goNode(v)
+	cb, _ := closureStartT(ctx, goPos(src), t)
+	n := len(body.Inner) - 1
+	for _, stmt := range body.Inner[:n] {
+		compileStmt(ctx, stmt)
+	}
+	compileExpr(ctx, body.Inner[n])
+	typeCast(ctx, t, cb.Get(-1))
+	cb.Return(1, src).End().CallWith(0, 0, src)
+}
+
+// compileAddrLabelExpr compiles &&label (address of label).
+func compileAddrLabelExpr(ctx *blockCtx, v *ast.Node) {
+	idx, ok := ctx.curfn.addrs[v.Name]
+	if !ok {
+		panicln(ErrNotImpl, "compileAddrLabelExpr: unknown label -", v.Name)
+	}
+	labelAddr(ctx, idx)
+}
+
+// checkStmtExprJumps checks that stmt doesn't jump out of the closure of a
+// statement expression.
+func checkStmtExprJumps(stmt *ast.Node, inLoop, inSwitch bool) {
+	switch stmt.Kind {
+	case ast.ReturnStmt, ast.GotoStmt, ast.IndirectGotoStmt:
+		panicln(ErrNotImpl, "TODO:", stmt.Kind, "in statement expression")
+	case ast.BreakStmt:
+		if !inLoop && !inSwitch {
+			panicln(ErrNotImpl, "TODO: break out of statement expression")
+		}
+	case ast.ContinueStmt:
+		if !inLoop {
+			panicln(ErrNotImpl, "TODO: continue out of statement expression")
+		}
+	case ast.ForStmt, ast.WhileStmt, ast.DoStmt:
+		inLoop = true
+	case ast.SwitchStmt:
+		inSwitch = true
+	}
+	for _, item := range stmt.Inner {
+		checkStmtExprJumps(item, inLoop, inSwitch)
+	}
+}
+
 func compileBinaryExpr(ctx *blockCtx, v *ast.Node, flags int) {
 	if op, ok := binaryOps[v.OpCode]; ok {
 		isBoolOp := (op == token.LOR || op == token.LAND)
 		isIf := isBoolOp && flags == flagIgnoreResult
+		if !isBoolOp && compileVLAPtrArith(ctx, op, v) {
+			return
+		}
 		cb := ctx.cb
 		if isIf {
 			cb.If()
@@ -366,12 +630,16 @@ func compileBinaryExpr(ctx *blockCtx, v *ast.Node, flags int) {
 		compileCommaExpr(ctx, v, flags)
 		return
 	default:
-		log.Panicln("compileBinaryExpr unknown operator:", v.OpCode)
+		panicln(ErrUnknownOp, "compileBinaryExpr unknown operator:", v.OpCode)
 	}
 	if (flags & flagIgnoreResult) != 0 {
 		compileSimpleAssignExpr(ctx, v)
 		return
 	}
+	if isBitField(ctx, v.Inner[0]) {
+		compileBitFieldOp(ctx, token.ILLEGAL, v, v.Inner[1], flags)
+		return
+	}
 	compileAssignExpr(ctx, v)
 }
 
@@ -413,6 +681,10 @@ var (
 
 func compileCompoundAssignOperator(ctx *blockCtx, v *ast.Node, flags int) {
 	if op, ok := assignOps[v.OpCode]; ok {
+		if isBitField(ctx, v.Inner[0]) {
+			compileBitFieldOp(ctx, op+(token.ADD-token.ADD_ASSIGN), v, v.Inner[1], flags)
+			return
+		}
 		if (flags & flagIgnoreResult) != 0 {
 			compileSimpleAssignOpExpr(ctx, op, v)
 		} else {
@@ -420,7 +692,7 @@ func compileCompoundAssignOperator(ctx *blockCtx, v *ast.Node, flags int) {
 		}
 		return
 	}
-	log.Panicln("compileCompoundAssignOperator unknown operator:", v.OpCode)
+	panicln(ErrUnknownOp, "compileCompoundAssignOperator unknown operator:", v.OpCode)
 }
 
 var (
@@ -465,6 +737,7 @@ func compileAssignExpr(ctx *blockCtx, v *ast.Node) {
 func compileSimpleAssignOpExpr(ctx *blockCtx, op token.Token, v *ast.Node) {
 	compileExprLHS(ctx, v.Inner[0])
 	compileExpr(ctx, v.Inner[1])
+	mulVLALen(ctx, v.Inner[0]) // p += n, p -= n
 	assignOp(ctx, op, ctx.goNode(v.Inner[1]))
 }
 
@@ -474,6 +747,7 @@ func compileAssignOpExpr(ctx *blockCtx, op token.Token, v *ast.Node) {
 	addr := cb.Scope().Lookup(addrVarName)
 	cb.Val(addr).ElemRef()
 	compileExpr(ctx, v.Inner[1])
+	mulVLALen(ctx, v.Inner[0]) // p += n, p -= n
 	assignOp(ctx, op, ctx.goNode(v.Inner[1]))
 
 	cb.Val(addr).Elem().Return(1).End().Call(0)
@@ -488,6 +762,11 @@ func compileSimpleIncDec(ctx *blockCtx, op token.Token, v *ast.Node) {
 		cb.UnaryOp(token.AND)
 		castPtrType(cb, tyUintptrPtr, stk.Pop())
 		cb.ElemRef()
+		if vla, ok := vlaPointee(ctx, v.Inner[0]); ok {
+			compileVLAStride(ctx, vla, v.Inner[0])
+			cb.AssignOp(op + (token.ADD_ASSIGN - token.INC))
+			return
+		}
 		if elemSize := ctx.sizeof(t.Elem()); elemSize != 1 {
 			cb.Val(elemSize).AssignOp(op + (token.ADD_ASSIGN - token.INC))
 			return
@@ -503,9 +782,17 @@ func compileIncDec(ctx *blockCtx, op token.Token, v *ast.Node) {
 	if v.IsPostfix {
 		cb.VarRef(ret).Val(addr).Elem().Assign(1)
 	}
-	elemSize := valOfAddr(cb, addr, ctx)
+	elem := valOfAddr(cb, addr, ctx)
 	cb.ElemRef()
-	if elemSize == 1 {
+	if elem == nil {
+		cb.IncDec(op)
+	} else if vla, ok := vlaPointee(ctx, v.Inner[0]); ok {
+		compileVLAStride(ctx, vla, v.Inner[0])
+		cb.AssignOp(op + (token.ADD_ASSIGN - token.INC))
+	} else if ctx.isNeutralSize(elem) {
+		ctx.unsafeSizeof(elem)
+		cb.AssignOp(op + (token.ADD_ASSIGN - token.INC))
+	} else if elemSize := ctx.sizeof(elem); elemSize == 1 {
 		cb.IncDec(op)
 	} else {
 		cb.Val(elemSize).AssignOp(op + (token.ADD_ASSIGN - token.INC))
@@ -517,6 +804,121 @@ func compileIncDec(ctx *blockCtx, op token.Token, v *ast.Node) {
 	cb.Return(n).End().Call(0)
 }
 
+// -----------------------------------------------------------------------------
+
+// isBitField checks if v is a bit-field member access expression: x.f or p->f.
+func isBitField(ctx *blockCtx, v *ast.Node) bool {
+	v = skipParen(v)
+	if v.Kind != ast.MemberExpr || v.Name == "" {
+		return false
+	}
+	t := toType(ctx, v.Inner[0].Type, 0)
+	if v.IsArrow {
+		if tptr, ok := t.(*types.Pointer); ok {
+			t = tptr.Elem()
+		}
+	}
+	if named, ok := t.(*types.Named); ok {
+		if vfs, ok := ctx.pkg.VFields(named); ok {
+			if bfs, ok := vfs.(*gox.BitFields); ok {
+				for i, n := 0, bfs.Len(); i < n; i++ {
+					if bfs.At(i).Name == v.Name {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// compileBitFieldOp compiles x.f op= rhs, ++x.f, x.f++, --x.f, x.f-- and (when
+// op is token.ILLEGAL) x.f = rhs, where x.f is a bit-field. A bit-field can
+// only be assigned, so they are lowered into x.f = x.f op rhs.
+func compileBitFieldOp(ctx *blockCtx, op token.Token, v, rhs *ast.Node, flags int) {
+	x := skipParen(v.Inner[0])
+	ignoreResult := (flags & flagIgnoreResult) != 0
+	if ignoreResult && isSimpleLHS(x.Inner[0]) {
+		compileExprLHS(ctx, x)
+		bitFieldValue(ctx, op, v, rhs, func() { compileExpr(ctx, x) })
+		return
+	}
+	pos := ctx.goNodePos(v)
+	cb := ctx.cb
+	var ret *types.Var
+	if ignoreResult {
+		cb.Block()
+	} else {
+		cb, ret = closureStart(ctx, pos, "_cgo_ret")
+	}
+	cb.DefineVarStart(pos, addrVarName)
+	if x.IsArrow {
+		compileExpr(ctx, x.Inner[0])
+	} else {
+		compileExprLHS(ctx, x.Inner[0])
+		cb.UnaryOp(token.AND)
+	}
+	cb.EndInit(1)
+	addr := cb.Scope().Lookup(addrVarName)
+	src := ctx.goNode(x)
+	if v.IsPostfix && !ignoreResult {
+		cb.VarRef(ret).Val(addr).MemberVal(x.Name, src).Assign(1)
+	}
+	cb.Val(addr).MemberRef(x.Name, src)
+	bitFieldValue(ctx, op, v, rhs, func() { cb.Val(addr).MemberVal(x.Name, src) })
+	switch {
+	case ignoreResult:
+		cb.End()
+	case v.IsPostfix:
+		cb.Return(0).End().Call(0)
+	default:
+		cb.Val(addr).MemberVal(x.Name, src).Return(1).End().Call(0)
+	}
+}
+
+// bitFieldValue assigns `x.f op rhs` (or rhs if op is token.ILLEGAL, or 1 if
+// rhs is nil) to the bit-field x.f referenced by the top of the stack, where
+// val pushes the old value of x.f.
+func bitFieldValue(ctx *blockCtx, op token.Token, v, rhs *ast.Node, val func()) {
+	cb := ctx.cb
+	stk := cb.InternalStack()
+	typ, _ := gox.DerefType(stk.Get(-1).Type)
+	if op != token.ILLEGAL {
+		val()
+	}
+	if rhs != nil {
+		compileExpr(ctx, rhs)
+	} else {
+		cb.Val(1)
+	}
+	src := ctx.goNode(v)
+	switch op {
+	case token.ILLEGAL:
+	case token.SHL, token.SHR:
+		shiftCount(ctx, typ, stk.Get(-1))
+		cb.BinaryOp(op, src)
+	default:
+		typeCast(ctx, typ, stk.Get(-1))
+		cb.BinaryOp(op, src)
+	}
+	assign(ctx, src)
+}
+
+// isSimpleLHS checks if v is an lvalue which can be evaluated more than once
+// without side effects, eg. a, a.b, p->a.
+func isSimpleLHS(v *ast.Node) bool {
+	v = skipParen(v)
+	switch v.Kind {
+	case ast.DeclRefExpr:
+		return true
+	case ast.MemberExpr:
+		return isSimpleLHS(v.Inner[0])
+	case ast.ImplicitCastExpr:
+		return v.CastKind == ast.LValueToRValue && isSimpleLHS(v.Inner[0])
+	}
+	return false
+}
+
 func closureStartInitAddr(ctx *blockCtx, v *ast.Node) (*gox.CodeBuilder, *types.Var) {
 	pos := ctx.goNodePos(v)
 	cb, ret := closureStart(ctx, pos, "_cgo_ret")
@@ -576,6 +978,9 @@ func returnIf(notVoid bool, cb *gox.CodeBuilder, src goast.Node) {
 func compileStarExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
 	cb := ctx.cb
 	compileExpr(ctx, v.Inner[0])
+	if _, ok := vlaOf(ctx, v); ok { // *p => p if p is a pointer to VLA
+		return
+	}
 	src := ctx.goNode(v)
 	if lhs {
 		cb.ElemRef(src)
@@ -593,10 +998,17 @@ func compileUnaryOperator(ctx *blockCtx, v *ast.Node, flags int) {
 		return
 	}
 	if lhs {
-		log.Panicln("compileUnaryOperator: not a lhs expression -", v.OpCode)
+		panicln(ErrNotImpl, "compileUnaryOperator: not a lhs expression -", v.OpCode)
 	}
 	if op, ok := unaryOps[v.OpCode]; ok {
+		if x := skipParen(v.Inner[0]); op == token.AND && x.Kind == ast.CompoundLiteralExpr {
+			compileCompoundLiteralAddr(ctx, x)
+			return
+		}
 		compileExpr(ctx, v.Inner[0])
+		if _, ok := vlaOf(ctx, v.Inner[0]); ok && op == token.AND { // &a => a if a is a VLA
+			return
+		}
 		unaryOp(ctx, op, v)
 		return
 	}
@@ -614,7 +1026,11 @@ func compileUnaryOperator(ctx *blockCtx, v *ast.Node, flags int) {
 		compileExpr(ctx, v.Inner[0])
 		return
 	default:
-		log.Panicln("compileUnaryOperator: unknown operator -", v.OpCode)
+		panicln(ErrUnknownOp, "compileUnaryOperator: unknown operator -", v.OpCode)
+	}
+	if isBitField(ctx, v.Inner[0]) {
+		compileBitFieldOp(ctx, tok+(token.ADD-token.INC), v, nil, flags)
+		return
 	}
 	if (flags & flagIgnoreResult) != 0 {
 		compileSimpleIncDec(ctx, tok, v)
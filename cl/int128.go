@@ -0,0 +1,161 @@
+package cl
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+
+// __int128 and unsigned __int128 are translated into clang.Int128 and
+// clang.Uint128. C operators on them are Gop_xxx methods, which are called by
+// gox as operator overloading, eg. a + b => a.Gop_Add(b).
+
+type int128Type struct {
+	*types.Named
+	fromInt64   *types.Func
+	fromUint64  *types.Func
+	fromFloat64 *types.Func
+}
+
+var (
+	tyInt128  = newInt128Type("Int128")
+	tyUint128 = newInt128Type("Uint128")
+)
+
+var (
+	int128BinaryOps = []string{"Add", "Sub", "Mul", "Quo", "Rem", "And", "Or", "Xor"}
+	int128ShiftOps  = []string{"Lsh", "Rsh"}
+	int128CmpOps    = []string{"LT", "LE", "GT", "GE"}
+	int128UnaryOps  = []string{"Neg", "Not", "Dup"}
+	int128IncDecOps = []string{"Inc", "Dec"}
+)
+
+func newInt128Type(name string) *int128Type {
+	u64 := types.Typ[types.Uint64]
+	flds := []*types.Var{
+		types.NewField(token.NoPos, clangPkg, "Lo", u64, false),
+		types.NewField(token.NoPos, clangPkg, "Hi", u64, false),
+	}
+	o := types.NewTypeName(token.NoPos, clangPkg, name, nil)
+	t := types.NewNamed(o, types.NewStruct(flds, nil), nil)
+	clangPkg.Scope().Insert(o)
+
+	recv := types.NewParam(token.NoPos, clangPkg, "a", t)
+	precv := types.NewParam(token.NoPos, clangPkg, "a", types.NewPointer(t))
+	newMethod := func(recv *types.Var, name string, params, results []*types.Var) {
+		sig := types.NewSignature(recv, types.NewTuple(params...), types.NewTuple(results...), false)
+		t.AddMethod(types.NewFunc(token.NoPos, clangPkg, name, sig))
+	}
+	param := func(typ types.Type) []*types.Var {
+		return []*types.Var{types.NewParam(token.NoPos, clangPkg, "", typ)}
+	}
+	tyUint, tyBool := types.Typ[types.Uint], types.Typ[types.Bool]
+	for _, op := range int128BinaryOps {
+		newMethod(recv, "Gop_"+op, param(t), param(t))
+		newMethod(precv, "Gop_"+op+"Assign", param(t), nil)
+	}
+	for _, op := range int128ShiftOps {
+		newMethod(recv, "Gop_"+op, param(tyUint), param(t))
+		newMethod(precv, "Gop_"+op+"Assign", param(tyUint), nil)
+	}
+	for _, op := range int128CmpOps {
+		newMethod(recv, "Gop_"+op, param(t), param(tyBool))
+	}
+	for _, op := range int128UnaryOps {
+		newMethod(recv, "Gop_"+op, nil, param(t))
+	}
+	for _, op := range int128IncDecOps {
+		newMethod(precv, "Gop_"+op, nil, nil)
+	}
+	newMethod(recv, "Int64", nil, param(types.Typ[types.Int64]))
+	newMethod(recv, "Uint64", nil, param(u64))
+	newMethod(recv, "Float64", nil, param(types.Typ[types.Float64]))
+
+	newFunc := func(fname string, from types.Type) *types.Func {
+		sig := types.NewSignature(nil, types.NewTuple(param(from)...), types.NewTuple(param(t)...), false)
+		fn := types.NewFunc(token.NoPos, clangPkg, name+fname, sig)
+		clangPkg.Scope().Insert(fn)
+		return fn
+	}
+	return &int128Type{
+		Named:       t,
+		fromInt64:   newFunc("FromInt64", types.Typ[types.Int64]),
+		fromUint64:  newFunc("FromUint64", u64),
+		fromFloat64: newFunc("FromFloat64", types.Typ[types.Float64]),
+	}
+}
+
+func int128Of(typ types.Type) *int128Type {
+	switch typ {
+	case tyInt128.Named:
+		return tyInt128
+	case tyUint128.Named:
+		return tyUint128
+	}
+	return nil
+}
+
+func is128(typ types.Type) bool {
+	return int128Of(typ) != nil
+}
+
+// cast128 pushes v converted to typ, where typ or type of v is a 128 bits
+// integer type.
+func cast128(ctx *blockCtx, typ types.Type, v *gox.Element) {
+	cb := ctx.cb
+	if t := int128Of(typ); t != nil {
+		if e, ok := gox.CastFromBool(cb, types.Typ[types.Int64], v); ok { // bool => int
+			v = e
+		}
+		switch {
+		case is128(v.Type): // Int128 <=> Uint128
+			cb.Typ(typ).Val(v).Call(1)
+		case isKind(v.Type, types.IsFloat):
+			cb.Val(t.fromFloat64)
+			convertTo(cb, types.Typ[types.Float64], v)
+			cb.Call(1)
+		case isUnsigned(v.Type) || isUint64Const(v):
+			cb.Val(t.fromUint64)
+			convertTo(cb, types.Typ[types.Uint64], v)
+			cb.Call(1)
+		default:
+			cb.Val(t.fromInt64)
+			convertTo(cb, types.Typ[types.Int64], v)
+			cb.Call(1)
+		}
+		return
+	}
+	switch {
+	case isBool(typ):
+		cb.Val(v).StructLit(v.Type, 0, false).BinaryOp(token.NEQ)
+	case isKind(typ, types.IsFloat):
+		convertTo(cb, typ, cb.Val(v).MemberVal("Float64").Call(0).InternalStack().Pop())
+	case isInteger(typ):
+		convertTo(cb, typ, cb.Val(v).MemberVal("Uint64").Call(0).InternalStack().Pop())
+	default:
+		panicln(ErrNotImpl, "TODO: cast", v.Type, "to", typ)
+	}
+}
+
+// convertTo pushes typ(v), or v itself if it is already of typ.
+func convertTo(cb *gox.CodeBuilder, typ types.Type, v *gox.Element) {
+	if types.Identical(typ, v.Type) {
+		cb.InternalStack().Push(v)
+	} else {
+		cb.Typ(typ).Val(v).Call(1)
+	}
+}
+
+func isUint64Const(v *gox.Element) bool {
+	if v.CVal != nil && v.CVal.Kind() == constant.Int {
+		_, ok := constant.Int64Val(v.CVal)
+		return !ok
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
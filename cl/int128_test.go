@@ -0,0 +1,57 @@
+package cl
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+// TestInt128Decls checks that clang.Int128 and clang.Uint128 used by cl are
+// consistent with their implementation in the clang package.
+func TestInt128Decls(t *testing.T) {
+	decls := clangFuncDecls(t, "../clang/int128.go")
+	for _, typ := range []*int128Type{tyInt128, tyUint128} {
+		name := typ.Obj().Name()
+		for i, n := 0, typ.NumMethods(); i < n; i++ {
+			if m := typ.Method(i); !decls[name+"."+m.Name()] {
+				t.Fatal("method not found:", name, m)
+			}
+		}
+		for _, fn := range []string{typ.fromInt64.Name(), typ.fromUint64.Name(), typ.fromFloat64.Name()} {
+			if !decls[fn] {
+				t.Fatal("func not found:", fn)
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// clangFuncDecls returns names of funcs and methods (as Type.Method) declared
+// in a file of the clang package.
+func clangFuncDecls(t *testing.T, file string) map[string]bool {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+	if err != nil {
+		t.Fatal("ParseFile:", err)
+	}
+	decls := make(map[string]bool)
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			name := fn.Name.Name
+			if fn.Recv != nil {
+				recv := fn.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				name = recv.(*ast.Ident).Name + "." + name
+			}
+			decls[name] = true
+		}
+	}
+	return decls
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,151 @@
+package cl
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"io"
+	"sort"
+
+	"github.com/weblfe/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+// A Record is a C struct or union which is translated into a Go type. Its
+// layout in C is got from clang by the caller (see Package.Records), so that
+// WriteLayoutTestTo can check the Go type has the same layout.
+type Record struct {
+	CType   string         // C type, eg. "struct foo", or name of a typedef of an unnamed record
+	GoType  string         // Go type which the record is translated into
+	SrcFile string         // the *.i file where the record is defined
+	Fields  []*RecordField // fields which are real fields of the Go type
+
+	Size, Align int64 // layout in C
+
+	alignInGo bool // if alignment of the Go type is expected to be Align
+}
+
+// A RecordField is a field of a Record. Virtual fields (bit fields, members of
+// unions and misaligned fields) aren't fields of the Go type, so they aren't
+// checked.
+type RecordField struct {
+	CName  string // name in C
+	GoName string // name in Go
+	Offset int64  // offset in C
+}
+
+// Records returns global C structs and unions translated by the package, which
+// have names in C. It requires conf.NeedRecords = true.
+func (p Package) Records() []*Record {
+	if p.pi == nil || p.pi.records == nil {
+		panic("Please set conf.NeedRecords = true")
+	}
+	recs := make([]*Record, 0, len(p.pi.records))
+	for _, r := range p.pi.records {
+		if r.CType != "" {
+			recs = append(recs, r)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].GoType < recs[j].GoType
+	})
+	return recs
+}
+
+// WriteLayoutTestTo writes a test which checks unsafe.Sizeof, unsafe.Alignof
+// and unsafe.Offsetof of Go types of records are the same as their layouts in
+// C. Layouts of all records must be set before.
+func (p Package) WriteLayoutTestTo(dst io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `package %s
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestLayout(t *testing.T) {
+	layouts := []struct {
+		expr      string
+		got, want uintptr
+	}{
+`, p.Types.Name())
+	for _, r := range p.Records() {
+		fmt.Fprintf(&b, "\t\t{%q, unsafe.Sizeof(%s{}), %d},\n", "sizeof("+r.CType+")", r.GoType, r.Size)
+		if r.alignInGo {
+			fmt.Fprintf(&b, "\t\t{%q, unsafe.Alignof(%s{}), %d},\n", "_Alignof("+r.CType+")", r.GoType, r.Align)
+		}
+		for _, f := range r.Fields {
+			expr := "offsetof(" + r.CType + ", " + f.CName + ")"
+			fmt.Fprintf(&b, "\t\t{%q, unsafe.Offsetof(%s{}.%s), %d},\n", expr, r.GoType, f.GoName, f.Offset)
+		}
+	}
+	b.WriteString(`	}
+	for _, v := range layouts {
+		if v.got != v.want {
+			t.Errorf("%s is %d in Go, but %d in C", v.expr, v.got, v.want)
+		}
+	}
+}
+`)
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(src)
+	return err
+}
+
+// -----------------------------------------------------------------------------
+
+// fieldNames returns names of fields of a record decl in C, before they are
+// renamed by avoidKeyword.
+func fieldNames(decl *ast.Node) []string {
+	names := make([]string, len(decl.Inner))
+	for i, item := range decl.Inner {
+		if item.Kind == ast.FieldDecl {
+			names[i] = item.Name
+		}
+	}
+	return names
+}
+
+// addRecord adds a global record t, whose decl is compiled, to records of the
+// package. cnames are names of fields of decl in C (see fieldNames).
+func (p *blockCtx) addRecord(t *types.Named, decl *ast.Node, cnames []string) {
+	if p.records == nil || p.curfn != nil {
+		return
+	}
+	r := &Record{GoType: t.Obj().Name(), SrcFile: p.srcfile}
+	if decl.Name != "" {
+		r.CType = decl.TagUsed + " " + decl.Name
+	}
+	_, alignDiffers := p.aligns[t]
+	r.alignInGo = !alignDiffers
+	struc := t.Underlying().(*types.Struct)
+	for i, item := range decl.Inner {
+		if item.Kind != ast.FieldDecl || item.IsBitfield || item.Name == "" {
+			continue
+		}
+		for j, n := 0, struc.NumFields(); j < n; j++ {
+			if fld := struc.Field(j); !fld.Embedded() && fld.Name() == item.Name {
+				r.Fields = append(r.Fields, &RecordField{CName: cnames[i], GoName: item.Name})
+				break
+			}
+		}
+	}
+	p.records[r.GoType] = r
+}
+
+// nameRecord names an unnamed record t by name of its typedef.
+func (p *blockCtx) nameRecord(t types.Type, name string) {
+	if named, ok := t.(*types.Named); ok && p.curfn == nil {
+		if r, ok := p.records[named.Obj().Name()]; ok && r.CType == "" {
+			r.CType = name
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,108 @@
+package cl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/weblfe/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestLayoutTest(t *testing.T) {
+	newNode := func(kind ast.Kind, name, typ string, inner ...*ast.Node) *ast.Node {
+		v := &ast.Node{Kind: kind, Name: name, Inner: inner, Loc: &ast.Loc{}}
+		if typ != "" {
+			v.Type = &ast.Type{QualType: typ}
+		}
+		return v
+	}
+	foo := newNode(ast.RecordDecl, "foo", "",
+		newNode(ast.FieldDecl, "c", "char"),
+		newNode(ast.FieldDecl, "type", "int"),
+		newNode(ast.FieldDecl, "d", "double"))
+	foo.TagUsed, foo.CompleteDefinition = "struct", true
+	bar := newNode(ast.RecordDecl, "", "",
+		newNode(ast.FieldDecl, "i", "int"),
+		newNode(ast.FieldDecl, "f", "float"))
+	bar.TagUsed, bar.CompleteDefinition, bar.ID = "union", true, "0x1"
+	elab := newNode("ElaboratedType", "", "")
+	elab.OwnedTagDecl = &ast.Node{ID: bar.ID, Kind: ast.RecordDecl}
+	doc := newNode(ast.TranslationUnitDecl, "", "", foo, bar, newNode(ast.TypedefDecl, "bar_t", "union bar_t", elab))
+
+	pkg, err := NewPackage("", "foo", doc, &Config{Src: []byte(" "), NeedRecords: true})
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	recs := pkg.Records()
+	if len(recs) != 2 {
+		t.Fatal("Records:", len(recs))
+	}
+	for _, r := range recs {
+		r.Size, r.Align = 16, 8
+		for i, f := range r.Fields {
+			f.Offset = int64(i * 4)
+		}
+	}
+	var b bytes.Buffer
+	if err = pkg.WriteLayoutTestTo(&b); err != nil {
+		t.Fatal("WriteLayoutTestTo:", err)
+	}
+	if s := b.String(); s != `package foo
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestLayout(t *testing.T) {
+	layouts := []struct {
+		expr      string
+		got, want uintptr
+	}{
+		{"sizeof(bar_t)", unsafe.Sizeof(_cgoa_1{}), 16},
+		{"_Alignof(bar_t)", unsafe.Alignof(_cgoa_1{}), 8},
+		{"offsetof(bar_t, i)", unsafe.Offsetof(_cgoa_1{}.i), 0},
+		{"sizeof(struct foo)", unsafe.Sizeof(struct_foo{}), 16},
+		{"_Alignof(struct foo)", unsafe.Alignof(struct_foo{}), 8},
+		{"offsetof(struct foo, c)", unsafe.Offsetof(struct_foo{}.c), 0},
+		{"offsetof(struct foo, type)", unsafe.Offsetof(struct_foo{}.type_), 4},
+		{"offsetof(struct foo, d)", unsafe.Offsetof(struct_foo{}.d), 8},
+	}
+	for _, v := range layouts {
+		if v.got != v.want {
+			t.Errorf("%s is %d in Go, but %d in C", v.expr, v.got, v.want)
+		}
+	}
+}
+` {
+		t.Fatal("WriteLayoutTestTo:", s)
+	}
+}
+
+func TestStaticAssert(t *testing.T) {
+	// long double is translated to float64, so it's 8 bytes in Go.
+	const src = "sizeof(long double)"
+	sizeof := newTestNode(ast.UnaryExprOrTypeTraitExpr, "unsigned long")
+	sizeof.Name = "sizeof"
+	sizeof.Range = &ast.Range{
+		Begin: ast.Pos{Offset: 0, TokLen: 6},
+		End:   ast.Pos{Offset: int64(len(src) - 1), TokLen: 1},
+	}
+	cond := newTestNode(ast.BinaryOperator, "int", sizeof, testIntLit("unsigned long", "16"))
+	cond.OpCode = "=="
+	msg := newTestNode(ast.StringLiteral, "char[27]")
+	msg.Value = `"\"long double\" is 16 bytes"`
+	doc := newTestNode(ast.TranslationUnitDecl, "", newTestNode(ast.StaticAssertDecl, "", cond, msg))
+
+	_, err := NewPackage("", "foo", doc, &Config{Src: []byte(src)})
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 || errs[0].Code != ErrLayout {
+		t.Fatal("NewPackage:", err)
+	}
+	if m := errs[0].Msg; m != `static assertion failed in Go: "long double" is 16 bytes` {
+		t.Fatal("static assert:", m)
+	}
+}
+
+// -----------------------------------------------------------------------------
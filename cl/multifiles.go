@@ -3,6 +3,7 @@ package cl
 import (
 	"encoding/json"
 	"go/token"
+	"go/types"
 	"log"
 	"os"
 	"path/filepath"
@@ -37,6 +38,11 @@ func (p *multiFileCtl) initMultiFileCtl(pkg *gox.Package, conf *Config) {
 			pi = new(PkgInfo)
 			pi.typdecls = make(map[string]*gox.TypeDecl)
 			pi.extfns = make(map[string]none)
+			pi.aligns = make(map[*types.Named]int)
+			pi.alignedVars = make(map[types.Object]none)
+			if conf.NeedRecords {
+				pi.records = make(map[string]*Record)
+			}
 			reused.pkg.pi = pi
 			reused.pkg.Package = pkg
 			reused.deps.init(conf)
@@ -44,6 +50,9 @@ func (p *multiFileCtl) initMultiFileCtl(pkg *gox.Package, conf *Config) {
 		}
 		p.typdecls = pi.typdecls
 		p.extfns = pi.extfns
+		p.aligns = pi.aligns
+		p.records = pi.records
+		p.alignedVars = pi.alignedVars
 		if reused.exists == nil {
 			reused.exists = make(map[string]none)
 		}
@@ -55,6 +64,11 @@ func (p *multiFileCtl) initMultiFileCtl(pkg *gox.Package, conf *Config) {
 	} else {
 		p.typdecls = make(map[string]*gox.TypeDecl)
 		p.extfns = make(map[string]none)
+		p.aligns = make(map[*types.Named]int)
+		p.alignedVars = make(map[types.Object]none)
+		if conf.NeedRecords {
+			p.records = make(map[string]*Record)
+		}
 		p.base = new(int)
 	}
 }
@@ -200,7 +214,11 @@ func (p *depPkgs) init(conf *Config) {
 			dir = canonical(depPkgDir, dir)
 			p.incs[dir] = incInDeps
 		}
-		pubfile := filepath.Join(depPkgDir, "c2go.a.pub")
+		outDir := depPkgDir
+		if conf.DepOutDir != nil {
+			outDir = conf.DepOutDir(depPkgDir)
+		}
+		pubfile := filepath.Join(outDir, "c2go.a.pub")
 		p.loadPubFile(dep, pubfile)
 	}
 }
@@ -1,9 +1,13 @@
 package cl
 
 import (
+	"bytes"
+	"go/format"
+	"strings"
 	"testing"
 
 	"github.com/goplus/gox"
+	"github.com/weblfe/c2go/clang/ast"
 )
 
 func TestInitDepPkgs(t *testing.T) {
@@ -19,3 +23,97 @@ func TestInitDepPkgs(t *testing.T) {
 		initDepPkgs(pkg, deps)
 	})
 }
+
+func TestAlignedVarsMultiFiles(t *testing.T) {
+	newNode := func(kind ast.Kind, name, typ string, inner ...*ast.Node) *ast.Node {
+		v := &ast.Node{Kind: kind, Name: name, Inner: inner, Loc: &ast.Loc{}}
+		if typ != "" {
+			v.Type = &ast.Type{QualType: typ}
+		}
+		return v
+	}
+	intLit := func(val string) *ast.Node {
+		v := newNode(ast.IntegerLiteral, "", "int")
+		v.Value = val
+		return v
+	}
+	alignedVar := func(name string, extern bool) *ast.Node { // _Alignas(16) int name;
+		v := newNode(ast.VarDecl, name, "int", newNode(ast.AlignedAttr, "", "", intLit("16")))
+		if extern {
+			v.StorageClass = ast.Extern
+		}
+		return v
+	}
+	assignFn := func(fn, name string) *ast.Node { // void fn(void) { name = 1; }
+		ref := newNode(ast.DeclRefExpr, "", "int")
+		ref.ReferencedDecl = &ast.Node{Name: name, Kind: ast.VarDecl}
+		assign := newNode(ast.BinaryOperator, "", "int", ref, intLit("1"))
+		assign.OpCode = "="
+		return newNode(ast.FunctionDecl, fn, "void (void)", newNode(ast.CompoundStmt, "", "", assign))
+	}
+	files := []*ast.Node{
+		newNode(ast.TranslationUnitDecl, "", "", alignedVar("x", false), alignedVar("y", true), assignFn("f", "y")),
+		newNode(ast.TranslationUnitDecl, "", "", alignedVar("y", false), assignFn("g", "x")),
+	}
+	var reused Reused
+	for _, file := range files {
+		if _, err := NewPackage("", "foo", file, &Config{Src: []byte(" "), Reused: &reused}); err != nil {
+			t.Fatal("NewPackage:", err)
+		}
+	}
+	pkg := reused.Pkg()
+	w := bytes.NewBuffer(nil)
+	format.Node(w, pkg.Fset, gox.ASTFile(pkg.Package))
+	out := w.String()
+	for _, s := range []string{"*y = int32(1)", "*x = int32(1)"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("%s not found:\n%s", s, out)
+		}
+	}
+}
+
+func TestLabelAddrsMultiFiles(t *testing.T) {
+	newNode := func(kind ast.Kind, name, typ string, inner ...*ast.Node) *ast.Node {
+		v := &ast.Node{Kind: kind, Name: name, Inner: inner, Loc: &ast.Loc{}}
+		if typ != "" {
+			v.Type = &ast.Type{QualType: typ}
+		}
+		return v
+	}
+	staticFn := func() *ast.Node { // static void f(void) { l: ; void *p = &&l; goto *p; }
+		p := newNode(ast.VarDecl, "p", "void *", newNode(ast.AddrLabelExpr, "l", "void *"))
+		p.Init = "c"
+		ref := newNode(ast.DeclRefExpr, "", "void *")
+		ref.ReferencedDecl = &ast.Node{Name: "p", Kind: ast.VarDecl}
+		ptr := newNode(ast.ImplicitCastExpr, "", "void *", ref)
+		ptr.CastKind = ast.LValueToRValue
+		body := newNode(ast.CompoundStmt, "", "",
+			newNode(ast.LabelStmt, "l", "", newNode(ast.NullStmt, "", "")),
+			newNode(ast.DeclStmt, "", "", p),
+			newNode(ast.IndirectGotoStmt, "", "", ptr))
+		fn := newNode(ast.FunctionDecl, "f", "void (void)", body)
+		fn.StorageClass = ast.Static
+		return fn
+	}
+	var reused Reused
+	for i := 0; i < 2; i++ {
+		file := newNode(ast.TranslationUnitDecl, "", "", staticFn())
+		if _, err := NewPackage("", "foo", file, &Config{Src: []byte(" "), Reused: &reused}); err != nil {
+			t.Fatal("NewPackage:", err)
+		}
+	}
+	pkg := reused.Pkg()
+	w := bytes.NewBuffer(nil)
+	format.Node(w, pkg.Fset, gox.ASTFile(pkg.Package))
+	out := w.String()
+	for _, s := range []string{
+		"var _cgo_labels_f_cgo1_cgo2 [1]uint8",
+		"var p unsafe.Pointer = unsafe.Pointer(&_cgo_labels_f_cgo1_cgo2[0])",
+		"var _cgo_labels_f_cgo3_cgo4 [1]uint8",
+		"var p unsafe.Pointer = unsafe.Pointer(&_cgo_labels_f_cgo3_cgo4[0])",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("%s not found:\n%s", s, out)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package cl
+
+import (
+	"go/token"
+	"go/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// In architecture-neutral mode (see Config.ArchNeutral), long and unsigned long
+// are translated into clang.Long and clang.Ulong, and sizeof/offsetof whose
+// results depend on the platform are translated into unsafe.Sizeof and
+// unsafe.Offsetof expressions instead of constants of the target.
+//
+// clang.Long and clang.Ulong are aliases of int32/int64 (uint32/uint64) by
+// build tags in the clang package (int32 on windows, which is LLP64), but cl
+// takes them as named types, so that generated code always converts them
+// explicitly, which compiles with both.
+
+const (
+	clangPkgPath = "github.com/weblfe/c2go/clang"
+)
+
+type archTypes struct {
+	long  *types.Named
+	ulong *types.Named
+}
+
+var (
+	clangPkg = types.NewPackage(clangPkgPath, "clang")
+
+	// archTypesOf[longSize] are types of the clang package. They are shared by
+	// all files, so that multiple C files of a Go package use the same types.
+	archTypesOf = map[int64]*archTypes{
+		4: newArchTypes(types.Typ[types.Int32], types.Typ[types.Uint32]),
+		8: newArchTypes(types.Typ[types.Int64], types.Typ[types.Uint64]),
+	}
+)
+
+func newArchTypes(long, ulong types.Type) *archTypes {
+	return &archTypes{
+		long:  newArchType("Long", long),
+		ulong: newArchType("Ulong", ulong),
+	}
+}
+
+func newArchType(name string, underlying types.Type) *types.Named {
+	o := types.NewTypeName(token.NoPos, clangPkg, name, nil)
+	return types.NewNamed(o, underlying, nil)
+}
+
+func isArchType(typ types.Type) bool {
+	t, ok := typ.(*types.Named)
+	return ok && t.Obj().Pkg() == clangPkg
+}
+
+func (p *blockCtx) tyLong() types.Type {
+	if p.archNeutral {
+		return archTypesOf[p.target.LongSize].long
+	}
+	return p.target.Long()
+}
+
+func (p *blockCtx) tyUlong() types.Type {
+	if p.archNeutral {
+		return archTypesOf[p.target.LongSize].ulong
+	}
+	return p.target.Ulong()
+}
+
+// sizeDependent reports whether sizeof typ depends on the platform.
+func sizeDependent(typ types.Type) bool {
+	switch t := typ.(type) {
+	case *types.Basic:
+		switch t.Kind() {
+		case types.Int, types.Uint, types.Uintptr, types.UnsafePointer, types.String:
+			return true
+		}
+	case *types.Pointer, *types.Signature, *types.Slice, *types.Map, *types.Chan, *types.Interface:
+		return true
+	case *types.Array:
+		return sizeDependent(t.Elem())
+	case *types.Named:
+		return isArchType(t) || sizeDependent(t.Underlying())
+	case *types.Struct:
+		for i, n := 0, t.NumFields(); i < n; i++ {
+			if ft := t.Field(i).Type(); sizeDependent(ft) || alignDependent(ft) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// alignDependent reports whether alignment of typ depends on the platform.
+func alignDependent(typ types.Type) bool {
+	switch t := typ.(type) {
+	case *types.Basic:
+		switch t.Kind() {
+		case types.Int64, types.Uint64, types.Float64, types.Complex128:
+			return true
+		}
+	case *types.Array:
+		return alignDependent(t.Elem())
+	case *types.Named:
+		return alignDependent(t.Underlying())
+	case *types.Struct:
+		for i, n := 0, t.NumFields(); i < n; i++ {
+			if alignDependent(t.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+	return sizeDependent(typ)
+}
+
+// typedZeroLit pushes a typed zero value of typ, eg. T{}, T(0) or (*T)(nil).
+func typedZeroLit(ctx *blockCtx, typ types.Type) {
+	switch typ.Underlying().(type) {
+	case *types.Struct:
+		ctx.cb.StructLit(typ, 0, false)
+	case *types.Array:
+		ctx.cb.ArrayLit(typ, 0)
+	default:
+		ctx.cb.Typ(typ).ZeroLit(typ).Call(1)
+	}
+}
+
+// isNeutralSize reports whether sizeof typ (or layout of typ) should be an
+// unsafe.Sizeof (or unsafe.Offsetof) expression, rather than a constant.
+func (p *blockCtx) isNeutralSize(typ types.Type) bool {
+	return p.archNeutral && sizeDependent(typ)
+}
+
+// unsafeSizeof pushes unsafe.Sizeof(typ{}).
+func (p *blockCtx) unsafeSizeof(typ types.Type) {
+	p.cb.Val(p.pkg.Builtin().Ref("Sizeof"))
+	typedZeroLit(p, typ)
+	p.cb.Call(1)
+}
+
+// unsafeAlignof pushes unsafe.Alignof(typ{}).
+func (p *blockCtx) unsafeAlignof(typ types.Type) {
+	p.cb.Val(p.pkg.Builtin().Ref("Alignof"))
+	typedZeroLit(p, typ)
+	p.cb.Call(1)
+}
+
+// unsafeOffsetof pushes unsafe.Offsetof(typ{}.name).
+func (p *blockCtx) unsafeOffsetof(typ types.Type, name string) {
+	p.cb.Val(p.pkg.Builtin().Ref("Offsetof"))
+	typedZeroLit(p, typ)
+	p.cb.MemberVal(name).Call(1)
+}
+
+// mulSizeof multiplies the top of the stack by sizeof typ.
+func (p *blockCtx) mulSizeof(typ types.Type) {
+	if p.isNeutralSize(typ) {
+		p.unsafeSizeof(typ)
+		p.cb.BinaryOp(token.MUL)
+	} else if size := p.sizeof(typ); size != 1 {
+		p.cb.Val(size).BinaryOp(token.MUL)
+	}
+}
+
+// divSizeof divides the top of the stack (a signed integer) by sizeof typ.
+func (p *blockCtx) divSizeof(typ types.Type) {
+	if p.isNeutralSize(typ) {
+		p.cb.Typ(p.cb.Get(-1).Type)
+		p.unsafeSizeof(typ)
+		p.cb.Call(1).BinaryOp(token.QUO)
+	} else if size := p.sizeof(typ); size != 1 {
+		p.cb.Val(size).BinaryOp(token.QUO)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,232 @@
+package cl
+
+import (
+	"bytes"
+	goast "go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gox"
+	"github.com/weblfe/c2go/clang/ast"
+
+	ctypes "github.com/weblfe/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestSizeDependent(t *testing.T) {
+	pkg := types.NewPackage("", "foo")
+	newStruct := func(typs ...types.Type) *types.Struct {
+		flds := make([]*types.Var, len(typs))
+		for i, typ := range typs {
+			flds[i] = types.NewField(token.NoPos, pkg, "f"+string(rune('a'+i)), typ, false)
+		}
+		return types.NewStruct(flds, nil)
+	}
+	long := archTypesOf[8].long
+	cases := []struct {
+		typ  types.Type
+		want bool
+	}{
+		{types.Typ[types.Int32], false},
+		{types.Typ[types.Int64], false},
+		{types.NewArray(types.Typ[types.Uint8], 10), false},
+		{newStruct(types.Typ[types.Int8], types.Typ[types.Int32]), false},
+		{newStruct(types.Typ[types.Int8], types.Typ[types.Float64]), true},
+		{long, true},
+		{types.NewArray(long, 2), true},
+		{ctypes.UnsafePointer, true},
+		{types.NewPointer(types.Typ[types.Int8]), true},
+		{newStruct(types.Typ[types.Int32], types.NewPointer(types.Typ[types.Int8])), true},
+	}
+	for _, c := range cases {
+		if got := sizeDependent(c.typ); got != c.want {
+			t.Fatal("sizeDependent:", c.typ, got)
+		}
+	}
+}
+
+func TestArchNeutral(t *testing.T) {
+	doc, src := parse(`
+struct foo {
+	char a;
+	long b;
+};
+
+unsigned long test(struct foo *p, int n) {
+	long x = sizeof(long) + sizeof(int) + __builtin_offsetof(struct foo, b);
+	p += n;
+	return x + p->b;
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, ArchNeutral: true})
+	check(err)
+	file := gox.ASTFile(pkg.Package)
+	w := bytes.NewBuffer(nil)
+	format.Node(w, pkg.Fset, file)
+	out := w.String()
+	for _, s := range []string{
+		"b clang.Long",
+		"func test(p *struct_foo, n int32) clang.Ulong",
+		"unsafe.Sizeof(clang.Long(0))",
+		"unsafe.Offsetof(struct_foo{}.b)",
+		"unsafe.Sizeof(struct_foo{})",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("%s not found:\n%s", s, out)
+		}
+	}
+}
+
+func newTestNode(kind ast.Kind, typ string, inner ...*ast.Node) *ast.Node {
+	v := &ast.Node{Kind: kind, Inner: inner, Loc: &ast.Loc{}}
+	if typ != "" {
+		v.Type = &ast.Type{QualType: typ}
+	}
+	return v
+}
+
+// testIntLit returns an int literal val which is converted to typ.
+func testIntLit(typ, val string) *ast.Node {
+	v := newTestNode(ast.IntegerLiteral, "int")
+	v.Value = val
+	return testCast(ast.IntegralCast, typ, v)
+}
+
+func testCast(kind ast.CastKind, typ string, x *ast.Node) *ast.Node {
+	v := newTestNode(ast.ImplicitCastExpr, typ, x)
+	v.CastKind = kind
+	return v
+}
+
+// testRValue returns value of the variable name of typ.
+func testRValue(name, typ string) *ast.Node {
+	ref := newTestNode(ast.DeclRefExpr, typ)
+	ref.ReferencedDecl = &ast.Node{Name: name, Kind: ast.VarDecl}
+	return testCast(ast.LValueToRValue, typ, ref)
+}
+
+func TestNamedScalarLit(t *testing.T) {
+	compLit := func(typ string, inits ...*ast.Node) *ast.Node {
+		return newTestNode(ast.CompoundLiteralExpr, typ, newTestNode(ast.InitListExpr, typ, inits...))
+	}
+	varDecl := func(name, typ string, init *ast.Node) *ast.Node {
+		v := newTestNode(ast.VarDecl, typ, init)
+		v.Name, v.Init = name, "c"
+		return newTestNode(ast.DeclStmt, "", v)
+	}
+	addr := newTestNode(ast.UnaryOperator, "long *", compLit("long", testIntLit("long", "5")))
+	addr.OpCode = "&"
+	body := newTestNode(ast.CompoundStmt, "",
+		varDecl("x", "long", compLit("long", testIntLit("long", "5"))),
+		varDecl("y", "__int128", compLit("__int128", testIntLit("__int128", "1"))),
+		varDecl("z", "long", compLit("long")),
+		varDecl("p", "long *", addr),
+		varDecl("a", "long [2]", newTestNode(ast.InitListExpr, "long [2]", testIntLit("long", "1"), testIntLit("long", "2"))))
+	fn := newTestNode(ast.FunctionDecl, "void (void)", body)
+	fn.Name = "test"
+	doc := newTestNode(ast.TranslationUnitDecl, "", fn)
+
+	pkg, err := NewPackage("", "foo", doc, &Config{Src: []byte(" "), ArchNeutral: true})
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	w := bytes.NewBuffer(nil)
+	format.Node(w, pkg.Fset, gox.ASTFile(pkg.Package))
+	out := w.String()
+	for _, s := range []string{
+		"var x clang.Long = clang.Long(5)",
+		"var y clang.Int128 = clang.Int128FromInt64(int64(int32(1)))",
+		"var z clang.Long = 0",
+		"var p *clang.Long = &[]clang.Long{clang.Long(5)}[0]",
+		"var a [2]clang.Long = [2]clang.Long{clang.Long(1), clang.Long(2)}",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("%s not found:\n%s", s, out)
+		}
+	}
+}
+
+// TestArchNeutralGOARCH checks that Go code generated in -neutral mode (for
+// either 32 or 64 bits C targets) compiles with clang.Long and clang.Ulong of
+// 32 bits, 64 bits and LLP64 platforms, although cl takes them as named types.
+func TestArchNeutralGOARCH(t *testing.T) {
+	binOp := func(op, typ string, x, y *ast.Node) *ast.Node {
+		v := newTestNode(ast.BinaryOperator, typ, x, y)
+		v.OpCode = ast.OpCode(op)
+		return v
+	}
+	param := func(name, typ string) *ast.Node {
+		v := newTestNode(ast.ParmVarDecl, typ)
+		v.Name = name
+		return v
+	}
+	// long x = 5;
+	// long f(long a, int b, unsigned long *p) { return a + b + *p; }
+	x := newTestNode(ast.VarDecl, "long", testIntLit("long", "5"))
+	x.Name, x.Init = "x", "c"
+	deref := newTestNode(ast.UnaryOperator, "unsigned long", testRValue("p", "unsigned long *"))
+	deref.OpCode = "*"
+	sum := binOp("+", "long", testRValue("a", "long"), testCast(ast.IntegralCast, "long", testRValue("b", "int")))
+	sum2 := binOp("+", "unsigned long", testCast(ast.IntegralCast, "unsigned long", sum),
+		testCast(ast.LValueToRValue, "unsigned long", deref))
+	ret := newTestNode(ast.ReturnStmt, "", testCast(ast.IntegralCast, "long", sum2))
+	fn := newTestNode(ast.FunctionDecl, "long (long, int, unsigned long *)",
+		param("a", "long"), param("b", "int"), param("p", "unsigned long *"), newTestNode(ast.CompoundStmt, "", ret))
+	fn.Name = "f"
+	doc := newTestNode(ast.TranslationUnitDecl, "", x, fn)
+
+	old := build.Default
+	defer func() { build.Default = old }()
+	platforms := []struct {
+		goos, goarch string
+		long         types.BasicKind // clang.Long of the platform
+	}{
+		{"linux", "386", types.Int32},
+		{"linux", "amd64", types.Int64},
+		{"windows", "amd64", types.Int32}, // LLP64
+	}
+	for _, triple := range []string{"i386-linux-gnu", "x86_64-linux-gnu", "x86_64-windows-msvc"} {
+		target, err := ctypes.ParseTarget(triple)
+		if err != nil {
+			t.Fatal("ParseTarget:", err)
+		}
+		pkg, err := NewPackage("", "foo", doc, &Config{Src: []byte(" "), ArchNeutral: true, Target: target})
+		if err != nil {
+			t.Fatal("NewPackage:", err)
+		}
+		w := bytes.NewBuffer(nil)
+		if err = pkg.WriteTo(w); err != nil {
+			t.Fatal("WriteTo:", err)
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "foo.go", w.Bytes(), 0)
+		if err != nil {
+			t.Fatal("ParseFile:", err)
+		}
+		for _, p := range platforms {
+			// the source importer imports the clang package of the platform
+			build.Default.GOOS, build.Default.GOARCH = p.goos, p.goarch
+			imp := importer.ForCompiler(fset, "source", nil)
+			conf := &types.Config{Importer: imp, Sizes: types.SizesFor("gc", p.goarch)}
+			if _, err = conf.Check("foo", fset, []*goast.File{f}, nil); err != nil {
+				t.Fatalf("%s => %s/%s: %v\n%s", triple, p.goos, p.goarch, err, w.Bytes())
+			}
+			clang, err := imp.Import(clangPkgPath)
+			if err != nil {
+				t.Fatal("Import:", err)
+			}
+			if long := clang.Scope().Lookup("Long").Type().Underlying(); long != types.Typ[p.long] {
+				t.Fatalf("%s/%s: clang.Long is %v", p.goos, p.goarch, long)
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,354 @@
+package cl
+
+import (
+	"bytes"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/gox"
+	"github.com/weblfe/c2go/clang/ast"
+
+	ctypes "github.com/weblfe/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// misalignedFields are fields of a struct which Go can't place at their offsets
+// in C, eg. fields of a packed struct and flexible array members. A misaligned
+// field x of type T at offset off is accessed by a pointer:
+//
+//	*(*T)(unsafe.Pointer(uintptr(unsafe.Pointer(&a)) + off))
+//
+// So the target must support unaligned memory access.
+type misalignedFields struct {
+	*gox.UnionFields
+}
+
+func (p *misalignedFields) lookup(name string) *gox.UnionField {
+	for i, n := 0, p.Len(); i < n; i++ {
+		if fld := p.At(i); fld.Name == name {
+			return fld
+		}
+	}
+	return nil
+}
+
+func (p *misalignedFields) offsetof(name string) (int, bool) {
+	if fld := p.lookup(name); fld != nil {
+		return fld.Off, true
+	}
+	return 0, false
+}
+
+// flexibleOnly reports whether all the fields are flexible array members.
+func (p *misalignedFields) flexibleOnly() bool {
+	for i, n := 0, p.Len(); i < n; i++ {
+		if !isFlexible(p.At(i).Type) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *blockCtx) getMisaligned(t *types.Named) (*misalignedFields, bool) {
+	if vfs, ok := p.pkg.VFields(t); ok {
+		mfs, ok := vfs.(*misalignedFields)
+		return mfs, ok
+	}
+	return nil, false
+}
+
+// isMisaligned reports whether name is a misaligned field of typ.
+func (p *blockCtx) isMisaligned(typ types.Type, name string) bool {
+	if t, ok := typ.(*types.Named); ok {
+		if mfs, ok := p.getMisaligned(t); ok {
+			_, ok = mfs.offsetof(name)
+			return ok
+		}
+	}
+	return false
+}
+
+// compileFlexibleDecay compiles x.a or p->a, where a is a flexible array member
+// of T at offset off, into a pointer to its first element:
+//
+//	(*T)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + off))
+//
+// It returns false if v isn't a flexible array member.
+func compileFlexibleDecay(ctx *blockCtx, v *ast.Node) bool {
+	v = skipParen(v)
+	if v.Kind != ast.MemberExpr || v.Name == "" {
+		return false
+	}
+	t := toType(ctx, v.Inner[0].Type, 0)
+	if tptr, ok := t.(*types.Pointer); ok && v.IsArrow {
+		t = tptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	mfs, ok := ctx.getMisaligned(named)
+	if !ok {
+		return false
+	}
+	name := v.Name
+	avoidKeyword(&name)
+	fld := mfs.lookup(name)
+	if fld == nil || !isFlexible(fld.Type) {
+		return false
+	}
+	cb := ctx.cb
+	cb.Typ(ctypes.NewPointer(fld.Type.(*types.Array).Elem())).Typ(ctypes.UnsafePointer)
+	if fld.Off != 0 {
+		cb.Typ(tyUintptr).Typ(ctypes.UnsafePointer)
+	}
+	compileExpr(ctx, v.Inner[0])
+	if !v.IsArrow {
+		cb.UnaryOp(token.AND)
+	}
+	if fld.Off != 0 {
+		cb.Call(1).Call(1).Val(fld.Off).BinaryOp(token.ADD)
+	}
+	cb.Call(1).Call(1)
+	return true
+}
+
+// misalignedLit pushes value of a struct literal of typ which has misaligned
+// fields:
+//
+//	func() (_cgo_ret T) {
+//		_cgo_ret.a = ...
+//		...
+//		return
+//	}()
+func misalignedLit(ctx *blockCtx, typ *types.Named, decl *ast.Node) {
+	pkg, cb := ctx.pkg, ctx.cb
+	t := typ.Underlying().(*types.Struct)
+	flds := make([]*types.Var, 0, len(decl.Inner))
+	for i, n := 0, t.NumFields(); i < n; i++ {
+		if fld := t.Field(i); !isPadding(fld) {
+			flds = append(flds, fld)
+		}
+	}
+	mfs, _ := ctx.getMisaligned(typ)
+	for i, n := 0, mfs.Len(); i < n; i++ {
+		fld := mfs.At(i)
+		flds = append(flds, types.NewField(fld.Pos, pkg.Types, fld.Name, fld.Type, false))
+	}
+	sort.SliceStable(flds, func(i, j int) bool { // in order of C fields
+		return ctx.offsetof(typ, flds[i].Name()) < ctx.offsetof(typ, flds[j].Name())
+	})
+	ret := pkg.NewParam(token.NoPos, "_cgo_ret", typ)
+	cb.NewClosure(nil, types.NewTuple(ret), false).BodyStart(pkg)
+	for i, initExpr := range decl.Inner {
+		if initExpr.Kind == ast.ImplicitValueInitExpr {
+			continue
+		}
+		fld := flds[i]
+		if isFlexible(fld.Type()) {
+			panicln(ErrNotImpl, "TODO: initialize flexible array member -", fld.Name())
+		}
+		cb.Val(ret).MemberRef(fld.Name())
+		initLit(ctx, fld.Type(), initExpr)
+		cb.Assign(1)
+	}
+	cb.Return(0).End().Call(0)
+}
+
+// -----------------------------------------------------------------------------
+
+// A record declared after `#pragma pack(N)` has a MaxFieldAlignmentAttr, but
+// clang doesn't dump N. So N is got from #pragma pack directives (and _Pragma
+// operators, which are usually turned into directives by the preprocessor) in
+// the preprocessed source, including those from headers. A record packed in
+// other ways, eg. by -fpack-struct, fails with ErrLayout.
+
+type packState struct {
+	off  int64 // offset of the end of a #pragma pack directive
+	pack int   // max alignment of fields after the directive, or 0 if not limited
+}
+
+// recordPack returns max alignment of fields of a record which is set by
+// #pragma pack, or 0 if it isn't limited.
+func (p *blockCtx) recordPack(rec *ast.Node) int {
+	if !hasAttr(rec, ast.MaxFieldAlignmentAttr) {
+		return 0
+	}
+	if rec.Range != nil {
+		off := rec.Range.Begin.Offset
+		if loc := rec.Range.Begin.ExpansionLoc; loc != nil { // declared by a macro
+			off = loc.Offset
+		}
+		if pack := p.pragmaPack(off); pack > 0 {
+			return pack
+		}
+	}
+	panicln(ErrLayout, "TODO: #pragma pack of", rec.Name, "not found")
+	return 0
+}
+
+// pragmaPack returns max alignment of fields at offset off, which is set by
+// #pragma pack directives before off.
+func (p *blockCtx) pragmaPack(off int64) int {
+	if p.packs == nil {
+		p.packs = parsePragmaPacks(p.src)
+	}
+	i := sort.Search(len(p.packs), func(i int) bool {
+		return p.packs[i].off > off
+	})
+	if i == 0 {
+		return 0
+	}
+	return p.packs[i-1].pack
+}
+
+// parsePragmaPacks parses #pragma pack directives and _Pragma("pack(...)")
+// operators in src:
+//
+//	#pragma pack(N)
+//	#pragma pack()
+//	#pragma pack(push[, id][, N])
+//	#pragma pack(pop[, id][, N])
+//
+// `pop, id` pops records of the stack until the one pushed with id is popped.
+func parsePragmaPacks(src []byte) []packState {
+	type record struct {
+		id   string
+		pack int
+	}
+	states := make([]packState, 0, 1)
+	stack := make([]record, 0, 4)
+	pack := 0
+	for off := 0; off < len(src); {
+		line := src[off:]
+		if n := bytes.IndexByte(line, '\n'); n >= 0 {
+			line = line[:n+1]
+		}
+		for _, pragma := range pragmaPacks(string(line)) {
+			args := pragma.args
+			id, newPack := "", -1
+			for _, arg := range args[1:] {
+				if n, err := strconv.Atoi(arg); err == nil {
+					newPack = n
+				} else if arg != "" {
+					id = arg
+				}
+			}
+			switch args[0] {
+			case "push":
+				stack = append(stack, record{id: id, pack: pack})
+			case "pop":
+				for n := len(stack); n > 0; n-- {
+					if id == "" || stack[n-1].id == id {
+						pack, stack = stack[n-1].pack, stack[:n-1]
+						break
+					}
+				}
+			case "":
+				if len(args) == 1 {
+					pack = 0 // #pragma pack()
+				}
+			default:
+				if n, err := strconv.Atoi(args[0]); err == nil {
+					newPack = n
+				}
+			}
+			if newPack >= 0 {
+				pack = newPack
+			}
+			states = append(states, packState{off: int64(off + pragma.end), pack: pack})
+		}
+		off += len(line)
+	}
+	return states
+}
+
+type pragmaPack struct {
+	args []string // arguments of pack(...)
+	end  int      // offset of the end of the pragma in its line
+}
+
+// pragmaPacks returns the #pragma pack directive in line, or _Pragma("pack(...)")
+// operators in it.
+func pragmaPacks(line string) (pragmas []pragmaPack) {
+	if text := strings.TrimSpace(line); strings.HasPrefix(text, "#") {
+		fields := strings.Fields(strings.TrimPrefix(text, "#"))
+		if len(fields) < 2 || fields[0] != "pragma" {
+			return
+		}
+		if args, ok := pragmaPackArgs(text[strings.Index(text, "pragma")+6:]); ok {
+			pragmas = append(pragmas, pragmaPack{args: args, end: len(line)})
+		}
+		return
+	}
+	for off := 0; ; {
+		i := strings.Index(line[off:], "_Pragma")
+		if i < 0 {
+			return
+		}
+		off += i + 7
+		text, n, ok := pragmaOperand(line[off:])
+		if !ok {
+			continue
+		}
+		off += n
+		if args, ok := pragmaPackArgs(text); ok {
+			pragmas = append(pragmas, pragmaPack{args: args, end: off})
+		}
+	}
+}
+
+// pragmaOperand parses `("text")` at the beginning of s, which is the operand
+// of _Pragma, and returns the unquoted text and length of the operand.
+func pragmaOperand(s string) (text string, n int, ok bool) {
+	rest := strings.TrimLeft(s, " \t")
+	if !strings.HasPrefix(rest, "(") {
+		return
+	}
+	rest = strings.TrimLeft(rest[1:], " \t")
+	if !strings.HasPrefix(rest, `"`) {
+		return
+	}
+	i := 1
+	for i < len(rest) && rest[i] != '"' {
+		if rest[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i >= len(rest) {
+		return
+	}
+	text, err := strconv.Unquote(rest[:i+1])
+	if err != nil {
+		return
+	}
+	rest = strings.TrimLeft(rest[i+1:], " \t")
+	if !strings.HasPrefix(rest, ")") {
+		return
+	}
+	return text, len(s) - len(rest) + 1, true
+}
+
+// pragmaPackArgs parses arguments of `pack(...)` in text of a pragma.
+func pragmaPackArgs(text string) (args []string, ok bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "pack") {
+		return
+	}
+	text = strings.TrimSpace(text[4:])
+	if !strings.HasPrefix(text, "(") || !strings.HasSuffix(text, ")") {
+		return
+	}
+	args = strings.Split(text[1:len(text)-1], ",")
+	for i, arg := range args {
+		args[i] = strings.TrimSpace(arg)
+	}
+	return args, true
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,64 @@
+package cl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weblfe/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestPragmaPack(t *testing.T) {
+	src := `struct a { char c; int x; };
+#pragma pack(2)
+struct b { char c; int x; };
+#pragma pack(push, 1)
+struct c { char c; int x; };
+  # pragma pack (push, r, 4)
+struct d { char c; int x; };
+#pragma pack(push, 8)
+struct h { char c; int x; };
+#pragma pack(pop, r)
+struct e { char c; int x; };
+#pragma pack(pop)
+struct f { char c; int x; };
+#pragma pack()
+struct g { char c; int x; };
+# 1 "pack.h" 1
+#pragma pack(4)
+struct i { char c; int x; };
+# 20 "foo.c" 2
+_Pragma("pack(push, 2)") struct j { char c; int x; }; _Pragma ( "pack(pop)" ) struct k { char c; int x; };
+`
+	ctx := &blockCtx{src: []byte(src)}
+	cases := map[string]int{"a": 0, "b": 2, "c": 1, "d": 4, "e": 1, "f": 2, "g": 0, "h": 8, "i": 4, "j": 2, "k": 4}
+	for name, pack := range cases {
+		off := strings.Index(src, "struct "+name)
+		if v := ctx.pragmaPack(int64(off)); v != pack {
+			t.Fatal("pragmaPack:", name, v)
+		}
+	}
+}
+
+// TestPragmaPackNotFound checks a packed record whose #pragma pack isn't in the
+// source, eg. packed by -fpack-struct.
+func TestPragmaPackNotFound(t *testing.T) {
+	rec := newTestNode(ast.RecordDecl, "",
+		newTestNode(ast.MaxFieldAlignmentAttr, ""),
+		newTestNode(ast.FieldDecl, "char"), newTestNode(ast.FieldDecl, "int"))
+	rec.Name, rec.TagUsed, rec.CompleteDefinition = "foo", "struct", true
+	rec.Inner[1].Name, rec.Inner[2].Name = "c", "x"
+	rec.Range = &ast.Range{Begin: ast.Pos{Offset: 16}}
+	doc := newTestNode(ast.TranslationUnitDecl, "", rec)
+	_, err := NewPackage("", "foo", doc, &Config{Src: []byte("struct foo { char c; int x; };\n")})
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 || errs[0].Code != ErrLayout {
+		t.Fatal("NewPackage:", err)
+	}
+	if msg := errs[0].Msg; msg != "TODO: #pragma pack of foo not found" {
+		t.Fatal("NewPackage:", msg)
+	}
+}
+
+// -----------------------------------------------------------------------------
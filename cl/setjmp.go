@@ -0,0 +1,226 @@
+package cl
+
+import (
+	"go/token"
+	"go/types"
+	"strconv"
+
+	"github.com/goplus/gox"
+	"github.com/weblfe/c2go/clang/ast"
+
+	ctypes "github.com/weblfe/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// A function which calls setjmp is translated into a loop of a closure, whose
+// body is resumed at a setjmp point after a longjmp (see clang.JmpFrame). A
+// setjmp point is the statement which calls setjmp, so it must be the only
+// setjmp of the statement, and the statement is executed again when resuming.
+
+var (
+	tyJmpFrame = newJmpFrameType()
+	longjmpFn  = newLongjmpFunc()
+)
+
+func newJmpFrameType() *types.Named {
+	o := types.NewTypeName(token.NoPos, clangPkg, "JmpFrame", nil)
+	t := types.NewNamed(o, types.NewStruct(nil, nil), nil)
+	clangPkg.Scope().Insert(o)
+
+	recv := types.NewParam(token.NoPos, clangPkg, "p", types.NewPointer(t))
+	newMethod := func(name string, params, results []types.Type) {
+		t.AddMethod(types.NewFunc(token.NoPos, clangPkg, name, newClangSig(recv, params, results)))
+	}
+	tyInt := types.Typ[types.Int]
+	newMethod("Setjmp", []types.Type{ctypes.UnsafePointer, tyInt}, []types.Type{ctypes.Int})
+	newMethod("Resume", nil, []types.Type{tyInt})
+	newMethod("Recover", nil, nil)
+	return t
+}
+
+func newLongjmpFunc() *types.Func {
+	sig := newClangSig(nil, []types.Type{ctypes.UnsafePointer, ctypes.Int}, nil)
+	fn := types.NewFunc(token.NoPos, clangPkg, "Longjmp", sig)
+	clangPkg.Scope().Insert(fn)
+	return fn
+}
+
+func newClangSig(recv *types.Var, params, results []types.Type) *types.Signature {
+	tuple := func(typs []types.Type) *types.Tuple {
+		vars := make([]*types.Var, len(typs))
+		for i, typ := range typs {
+			vars[i] = types.NewParam(token.NoPos, clangPkg, "", typ)
+		}
+		return types.NewTuple(vars...)
+	}
+	return types.NewSignature(recv, tuple(params), tuple(results), false)
+}
+
+const (
+	jmpNone = iota
+	jmpSetjmp
+	jmpLongjmp
+)
+
+// jmpKindOf checks if fn (the callee of a call) is setjmp or longjmp.
+func jmpKindOf(fn *ast.Node) int {
+	if fn.Kind == ast.ImplicitCastExpr && fn.CastKind == ast.FunctionToPointerDecay {
+		if ref := fn.Inner[0]; ref.Kind == ast.DeclRefExpr && ref.ReferencedDecl != nil {
+			return jmpKindOfName(ref.ReferencedDecl.Name)
+		}
+	}
+	return jmpNone
+}
+
+func jmpKindOfName(name string) int {
+	switch name {
+	case "setjmp", "_setjmp", "sigsetjmp", "__sigsetjmp":
+		return jmpSetjmp
+	case "longjmp", "_longjmp", "siglongjmp", "__longjmp_chk":
+		return jmpLongjmp
+	}
+	return jmpNone
+}
+
+// findSetjmp returns the setjmp call in expr, or nil if expr doesn't call
+// setjmp.
+func findSetjmp(expr *ast.Node) (call *ast.Node) {
+	if expr.Kind == ast.CallExpr && len(expr.Inner) > 0 && jmpKindOf(expr.Inner[0]) == jmpSetjmp {
+		call = expr
+	}
+	for _, item := range expr.Inner {
+		if v := findSetjmp(item); v != nil {
+			if call != nil {
+				panicln(ErrNotImpl, "TODO: multiple setjmp calls in a statement")
+			}
+			call = v
+		}
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// markSetjmp makes stmt a setjmp point if expr (a part of stmt) calls setjmp.
+// A setjmp point is a label referred at the function entry.
+func (p *markCtx) markSetjmp(stmt, expr *ast.Node) {
+	call := findSetjmp(expr)
+	if call == nil {
+		return
+	}
+	if p.setjmps == nil {
+		p.setjmps = make(map[*ast.Node]int)
+	}
+	p.npoint++
+	p.setjmps[stmt], p.setjmps[call] = p.npoint, p.npoint
+	name := "setjmp#" + strconv.Itoa(p.npoint) // not a valid C label
+	l := p.reqLabel(name)
+	l.defineLabel(name, p.current)
+	l.useLabel(name, nil)
+}
+
+func (p *markCtx) checkNoSetjmp(expr *ast.Node, where string) {
+	if findSetjmp(expr) != nil {
+		panicln(ErrNotImpl, "TODO: setjmp in", where)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// compileSetjmpFuncBody compiles body of a function which calls setjmp:
+//
+//	var _cgo_jf clang.JmpFrame
+//	for {
+//		_cgo_ret := func() T {
+//			defer _cgo_jf.Recover()
+//			if _cgo_jf.Resume() == 1 {
+//				goto _cgo_jmp_1
+//			}
+//			...
+//		}()
+//		if _cgo_jf.Resume() == 0 {
+//			return _cgo_ret
+//		}
+//	}
+//
+// Variables of the function are defined out of the closure, so that they
+// keep their values after a longjmp.
+func compileSetjmpFuncBody(ctx *blockCtx, body *ast.Node, setjmps map[*ast.Node]int, npoint int) {
+	const (
+		frameName = "_cgo_jf"
+		retName   = "_cgo_ret"
+	)
+	cb, pkg := ctx.cb, ctx.pkg
+	fn := ctx.curfn
+	fn.setjmps = setjmps
+	fn.jmpFrame = fn.vdefs.New(token.NoPos, tyJmpFrame, frameName).Ref(frameName)
+	fn.jmpLabels = make([]*gox.Label, npoint)
+	for i := range fn.jmpLabels {
+		fn.jmpLabels[i] = cb.NewLabel(token.NoPos, "_cgo_jmp_"+strconv.Itoa(i+1))
+	}
+
+	results := cb.Func().Type().(*types.Signature).Results()
+	hasRet := results.Len() > 0
+	cb.For().None().Then()
+	if hasRet {
+		cb.DefineVarStart(token.NoPos, retName)
+	}
+	cb.NewClosure(nil, results, false).BodyStart(pkg)
+	cb.Val(fn.jmpFrame).MemberVal("Recover").Call(0).Defer()
+	for i, l := range fn.jmpLabels {
+		cb.If().Val(fn.jmpFrame).MemberVal("Resume").Call(0).Val(i + 1).BinaryOp(token.EQL).Then().
+			Goto(l).
+			End()
+	}
+	cb.VBlock()
+	compileSub(ctx, body)
+	checkNeedReturn(ctx, body)
+	cb.End() // vblock
+	cb.End().Call(0)
+	n := 0
+	if hasRet {
+		cb.EndInit(1)
+		ret := cb.Scope().Lookup(retName)
+		cb.If().Val(fn.jmpFrame).MemberVal("Resume").Call(0).Val(0).BinaryOp(token.EQL).Then()
+		cb.Val(ret)
+		n = 1
+	} else {
+		cb.EndStmt()
+		cb.If().Val(fn.jmpFrame).MemberVal("Resume").Call(0).Val(0).BinaryOp(token.EQL).Then()
+	}
+	cb.Return(n).End() // if
+	cb.End()           // for
+}
+
+// labelSetjmp defines the label of stmt if it is a setjmp point.
+func labelSetjmp(ctx *blockCtx, stmt *ast.Node) {
+	if fn := ctx.curfn; fn != nil && fn.setjmps != nil {
+		if point, ok := fn.setjmps[stmt]; ok {
+			ctx.cb.Label(fn.jmpLabels[point-1])
+		}
+	}
+}
+
+// compileSetjmp compiles setjmp(env) into _cgo_jf.Setjmp(unsafe.Pointer(env), point).
+func compileSetjmp(ctx *blockCtx, v *ast.Node) {
+	fn := ctx.curfn
+	point, ok := fn.setjmps[v]
+	if !ok {
+		panicln(ErrNotImpl, "TODO: unexpected setjmp")
+	}
+	cb := ctx.cb.Val(fn.jmpFrame).MemberVal("Setjmp")
+	compileUnsafePointer(ctx, v.Inner[1])
+	cb.Val(point).CallWith(2, 0, ctx.goNode(v))
+}
+
+// compileLongjmp compiles longjmp(env, val) into clang.Longjmp(unsafe.Pointer(env), val).
+func compileLongjmp(ctx *blockCtx, v *ast.Node) {
+	cb := ctx.cb.Val(longjmpFn)
+	compileUnsafePointer(ctx, v.Inner[1])
+	compileExpr(ctx, v.Inner[2])
+	typeCast(ctx, ctypes.Int, cb.Get(-1))
+	cb.CallWith(2, 0, ctx.goNode(v))
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,37 @@
+package cl
+
+import (
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+// TestSetjmpDecls checks that clang.JmpFrame and clang.Longjmp used by cl are
+// consistent with their implementation in the clang package.
+func TestSetjmpDecls(t *testing.T) {
+	decls := clangFuncDecls(t, "../clang/setjmp.go")
+	name := tyJmpFrame.Obj().Name()
+	for i, n := 0, tyJmpFrame.NumMethods(); i < n; i++ {
+		if m := tyJmpFrame.Method(i); !decls[name+"."+m.Name()] {
+			t.Fatal("method not found:", name, m)
+		}
+	}
+	if !decls[longjmpFn.Name()] {
+		t.Fatal("func not found:", longjmpFn)
+	}
+}
+
+func TestJmpKindOf(t *testing.T) {
+	cases := map[string]int{
+		"setjmp": jmpSetjmp, "_setjmp": jmpSetjmp, "sigsetjmp": jmpSetjmp, "__sigsetjmp": jmpSetjmp,
+		"longjmp": jmpLongjmp, "_longjmp": jmpLongjmp, "siglongjmp": jmpLongjmp, "__longjmp_chk": jmpLongjmp,
+		"printf": jmpNone,
+	}
+	for name, kind := range cases {
+		if v := jmpKindOfName(name); v != kind {
+			t.Fatal("jmpKindOfName:", name, v)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
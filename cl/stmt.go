@@ -3,15 +3,18 @@ package cl
 import (
 	"go/token"
 	"go/types"
-	"log"
 
 	"github.com/goplus/gox"
 	"github.com/weblfe/c2go/clang/ast"
+
+	ctypes "github.com/weblfe/c2go/clang/types"
 )
 
 // -----------------------------------------------------------------------------
 
 func compileStmt(ctx *blockCtx, stmt *ast.Node) {
+	old := ctx.enter(stmt)
+	labelSetjmp(ctx, stmt)
 	switch stmt.Kind {
 	case ast.IfStmt:
 		compileIfStmt(ctx, stmt)
@@ -35,6 +38,8 @@ func compileStmt(ctx *blockCtx, stmt *ast.Node) {
 		compileCompoundStmt(ctx, stmt)
 	case ast.GotoStmt:
 		compileGotoStmt(ctx, stmt)
+	case ast.IndirectGotoStmt:
+		compileIndirectGotoStmt(ctx, stmt)
 	case ast.LabelStmt:
 		compileLabelStmt(ctx, stmt)
 	case ast.CaseStmt, ast.DefaultStmt:
@@ -46,6 +51,7 @@ func compileStmt(ctx *blockCtx, stmt *ast.Node) {
 		compileExprEx(ctx, stmt, "compileStmt: unknown kind =", flagIgnoreResult)
 		ctx.cb.EndStmt()
 	}
+	ctx.curnode = old
 }
 
 // -----------------------------------------------------------------------------
@@ -216,7 +222,8 @@ func compileCompoundStmt(ctx *blockCtx, cStmt *ast.Node) {
 
 func compileForStmt(ctx *blockCtx, stmt *ast.Node) {
 	if stmt.Complicated {
-		log.Panicln("TODO: compileComplicatedForStmt")
+		compileComplicatedForStmt(ctx, stmt)
+		return
 	}
 
 	flow := ctx.enterFlow(flowKindLoop)
@@ -225,7 +232,7 @@ func compileForStmt(ctx *blockCtx, stmt *ast.Node) {
 	cb := ctx.cb.For()
 	compileInitStmt(ctx, stmt.Inner[0])
 	if stmt := stmt.Inner[1]; stmt.Kind != "" {
-		log.Panicln("compileForStmt: unexpected -", stmt.Kind)
+		panicln(ErrUnknownKind, "compileForStmt: unexpected -", stmt.Kind)
 	}
 	if cond := stmt.Inner[2]; cond.Kind != "" {
 		compileExpr(ctx, cond)
@@ -242,6 +249,42 @@ func compileForStmt(ctx *blockCtx, stmt *ast.Node) {
 	cb.End()
 }
 
+func compileComplicatedForStmt(ctx *blockCtx, stmt *ast.Node) {
+	loop := ctx.enterLoop()
+	defer ctx.leave(loop)
+
+	if initStmt := stmt.Inner[0]; initStmt.Kind != "" {
+		compileStmt(ctx, initStmt)
+	}
+	if stmt := stmt.Inner[1]; stmt.Kind != "" {
+		panicln(ErrUnknownKind, "compileForStmt: unexpected -", stmt.Kind)
+	}
+	loop.labelStart(ctx)
+
+	cb := ctx.cb
+	if cond := stmt.Inner[2]; cond.Kind != "" {
+		cb.If()
+		compileExpr(ctx, cond)
+		castToBoolExpr(cb)
+		done := loop.EndLabel(ctx)
+		cb.UnaryOp(token.NOT).Then().Goto(done).End()
+	}
+
+	postStmt := stmt.Inner[3]
+	loop.hasPost = postStmt.Kind != ""
+	compileSub(ctx, stmt.Inner[4])
+	if loop.post != nil {
+		cb.Label(loop.post)
+	}
+	if loop.hasPost {
+		compileStmt(ctx, postStmt)
+	}
+	cb.Goto(loop.start)
+	if loop.done != nil {
+		cb.Label(loop.done)
+	}
+}
+
 func compileInitStmt(ctx *blockCtx, initStmt *ast.Node) {
 	switch initStmt.Kind {
 	case "":
@@ -311,19 +354,18 @@ func compileCaseStmt(ctx *blockCtx, stmt *ast.Node) {
 	cb := ctx.cb
 	sw := ctx.getSwitchCtx()
 	if sw == nil {
-		log.Panicln("compileCaseStmt: case stmt isn't in switch")
+		panicln(ErrNotImpl, "compileCaseStmt: case stmt isn't in switch")
 	}
 	var idx int
 	if isCaseStmt {
 		if sw.next != nil {
 			cb.Label(sw.next)
 		}
-		cb.If().Val(sw.notmat).Val(sw.tag)
-		compileExpr(ctx, stmt.Inner[0])
-		cb.BinaryOp(token.NEQ).BinaryOp(token.LAND).Then()
+		cb.If().Val(sw.notmat)
+		idx = compileCaseCond(ctx, sw.tag, stmt, true)
+		cb.BinaryOp(token.LAND).Then()
 		l := sw.nextCaseLabel(ctx)
 		cb.Goto(l).End()
-		idx = 1
 	} else {
 		sw.labelDefault(ctx)
 	}
@@ -331,6 +373,39 @@ func compileCaseStmt(ctx *blockCtx, stmt *ast.Node) {
 	compileStmt(ctx, stmt.Inner[idx])
 }
 
+// compileCaseCond compiles `tag == v` (or `tag >= lo && tag <= hi` for a case
+// range `case lo ... hi:`) of a case stmt, or its negation if not is true. It
+// returns index of the case body in stmt.Inner.
+func compileCaseCond(ctx *blockCtx, tag types.Object, stmt *ast.Node, not bool) int {
+	eq, ge, le, and := token.EQL, token.GEQ, token.LEQ, token.LAND
+	if not {
+		eq, ge, le, and = token.NEQ, token.LSS, token.GTR, token.LOR
+	}
+	cb := ctx.cb.Val(tag)
+	compileExpr(ctx, stmt.Inner[0])
+	if !stmt.IsGNURange {
+		cb.BinaryOp(eq)
+		return 1
+	}
+	cb.BinaryOp(ge).Val(tag)
+	compileExpr(ctx, stmt.Inner[1])
+	cb.BinaryOp(le).BinaryOp(and)
+	return 2
+}
+
+// hasCaseRange checks if a simple switch body has a case range.
+func hasCaseRange(body *ast.Node) bool {
+	for _, stmt := range body.Inner {
+		for stmt.Kind == ast.CaseStmt || stmt.Kind == ast.DefaultStmt {
+			if stmt.IsGNURange {
+				return true
+			}
+			stmt = stmt.Inner[len(stmt.Inner)-1]
+		}
+	}
+	return false
+}
+
 func firstStmtNotCase(body *ast.Node) bool {
 	if body.Kind != ast.CompoundStmt || len(body.Inner) == 0 {
 		return true
@@ -346,13 +421,23 @@ func compileSimpleSwitchStmt(ctx *blockCtx, switchStmt *ast.Node) {
 	flow := ctx.enterFlow(flowKindSwitch)
 	defer ctx.leave(flow)
 
-	cb := ctx.cb.Switch()
-	compileExpr(ctx, switchStmt.Inner[0])
-	cb.Then()
 	body := switchStmt.Inner[1]
 	if body.Kind != ast.CompoundStmt {
-		log.Panicln("compileSimpleSwitchStmt: not a simple switch stmt")
+		panicln(ErrNotImpl, "compileSimpleSwitchStmt: not a simple switch stmt")
 	}
+	cb := ctx.cb.Switch()
+	var tag types.Object
+	if hasCaseRange(body) { // switch _tag := expr; { case _tag >= lo && _tag <= hi: ... }
+		const tagName = "_tag"
+		cb.DefineVarStart(token.NoPos, tagName)
+		compileExpr(ctx, switchStmt.Inner[0])
+		cb.EndInit(1)
+		tag = cb.Scope().Lookup(tagName)
+		cb.None()
+	} else {
+		compileExpr(ctx, switchStmt.Inner[0])
+	}
+	cb.Then()
 	bodyStmts := body.Inner
 	hasCase := false
 	for i, n := 0, len(bodyStmts); i < n; i++ {
@@ -372,9 +457,15 @@ func compileSimpleSwitchStmt(ctx *blockCtx, switchStmt *ast.Node) {
 			hasCase = false
 		}
 		if idx != 0 {
-			compileExpr(ctx, stmt.Inner[0])
+			if tag != nil {
+				idx = compileCaseCond(ctx, tag, stmt, false)
+			} else {
+				compileExpr(ctx, stmt.Inner[0])
+			}
+			cb.Case(1)
+		} else {
+			cb.Case(0)
 		}
-		cb.Case(idx)
 		switch caseBody := stmt.Inner[idx]; caseBody.Kind {
 		case ast.CaseStmt, ast.DefaultStmt:
 			cb.Fallthrough().End()
@@ -421,6 +512,54 @@ func compileGotoStmt(ctx *blockCtx, stmt *ast.Node) {
 	ctx.cb.Goto(l)
 }
 
+// newLabelAddrs defines `var _cgo_labels_fn_cgoN [N]byte` for labels whose
+// addresses are taken in function fn. Address of the i-th label is
+// &_cgo_labels_fn_cgoN[i]. It's at package scope, so like static variables, the
+// suffix keeps its name unique in the package.
+func newLabelAddrs(ctx *blockCtx, fnName string, addrs map[string]int) {
+	name := ctx.autoStaticName("_cgo_labels_" + fnName)
+	typ := types.NewArray(types.Typ[types.Byte], int64(len(addrs)))
+	fn := ctx.curfn
+	fn.addrs = addrs
+	defs, _ := ctx.newVar(ctx.pkg.Types.Scope(), token.NoPos, typ, name)
+	fn.addrBase = defs.Ref(name)
+}
+
+// compileIndirectGotoStmt compiles `goto *addr` into:
+//
+//	switch uintptr(addr) - uintptr(unsafe.Pointer(&_cgo_labels_fn_cgoN[0])) {
+//	case 0:
+//		goto label0
+//	...
+//	}
+func compileIndirectGotoStmt(ctx *blockCtx, stmt *ast.Node) {
+	fn := ctx.curfn
+	if fn.addrs == nil {
+		panicln(ErrNotImpl, "TODO: goto *addr without label address")
+	}
+	tyUintptr := types.Typ[types.Uintptr]
+	cb := ctx.cb.Switch().Typ(tyUintptr)
+	compileUnsafePointer(ctx, stmt.Inner[0])
+	cb.Call(1).Typ(tyUintptr)
+	labelAddr(ctx, 0)
+	cb.Call(1).BinaryOp(token.SUB).Then()
+	labels := make([]string, len(fn.addrs))
+	for name, i := range fn.addrs {
+		labels[i] = name
+	}
+	pos := ctx.goNodePos(stmt)
+	for i, name := range labels {
+		cb.Val(i).Case(1).Goto(ctx.getLabel(pos, name)).End()
+	}
+	cb.End()
+}
+
+// labelAddr pushes address of the i-th label whose address is taken, that is
+// unsafe.Pointer(&_cgo_labels_fn_cgoN[i]).
+func labelAddr(ctx *blockCtx, i int) {
+	ctx.cb.Typ(ctypes.UnsafePointer).Val(ctx.curfn.addrBase).Val(i).IndexRef(1).UnaryOp(token.AND).Call(1)
+}
+
 func compileReturnStmt(ctx *blockCtx, stmt *ast.Node) {
 	n := len(stmt.Inner)
 	if n > 0 {
@@ -39,6 +39,17 @@ void foo(int a, int b) {
 		;
 	}
 }
+`},
+		{name: "CaseRange", simple: true, code: `
+void foo(int a, int b) {
+	switch (a) {
+	case 1 ... 3:
+		b = 0;
+	case 5:
+	case 7 ... 9:
+		b = 1;
+	}
+}
 `},
 		{name: "GotoAcross", simple: false, code: `
 void foo(int a, int b) {
@@ -51,6 +62,17 @@ void foo(int a, int b) {
 		next: ;
 	}
 }
+`},
+		{name: "IndirectGoto", simple: false, code: `
+void foo(int a, int b) {
+	void *next = &&done;
+	switch (a) {
+	case 1:
+		goto *next;
+	default:
+		done: ;
+	}
+}
 `},
 		{name: "CaseAcross", simple: false, code: `
 void foo(int a, int b) {
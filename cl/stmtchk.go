@@ -81,7 +81,7 @@ type labelCtx struct {
 
 func (p *labelCtx) defineLabel(name string, at *blockMarkCtx) {
 	if p.defined {
-		log.Panicln("defineLabel: label exists -", name)
+		panicln(ErrNotImpl, "defineLabel: label exists -", name)
 	}
 	p.at, p.defined = at, true
 	if debugMarkComplicated {
@@ -123,6 +123,9 @@ type markCtx struct {
 	current   *blockMarkCtx
 	owner     *ownerStmtCtx
 	labels    map[string]*labelCtx
+	setjmps   map[*ast.Node]int // setjmp point of statements and setjmp calls
+	npoint    int               // number of setjmp points
+	addrs     map[string]int    // index of labels whose addresses are taken (&&label)
 	complicat bool
 }
 
@@ -180,6 +183,7 @@ func (p *markCtx) markBody(ctx *blockCtx, stmt *ast.Node) {
 func (p *markCtx) mark(ctx *blockCtx, stmt *ast.Node) {
 	switch stmt.Kind {
 	case ast.IfStmt:
+		p.markSetjmp(stmt, stmt.Inner[0])
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "ifBody", stmt.Inner[1])
@@ -189,14 +193,19 @@ func (p *markCtx) mark(ctx *blockCtx, stmt *ast.Node) {
 	case ast.SwitchStmt:
 		p.markSwitch(ctx, stmt)
 	case ast.ForStmt:
+		p.markSetjmp(stmt, stmt.Inner[0])
+		p.checkNoSetjmp(stmt.Inner[2], "for condition")
+		p.checkNoSetjmp(stmt.Inner[3], "for post statement")
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "forBody", stmt.Inner[4])
 	case ast.WhileStmt:
+		p.markSetjmp(stmt, stmt.Inner[0])
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "whileBody", stmt.Inner[1])
 	case ast.DoStmt:
+		p.checkNoSetjmp(stmt.Inner[1], "do-while condition")
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "doBody", stmt.Inner[0])
@@ -206,12 +215,18 @@ func (p *markCtx) mark(ctx *blockCtx, stmt *ast.Node) {
 	case ast.GotoStmt:
 		name := ctx.labelOfGoto(stmt)
 		p.reqLabel(name).useLabel(name, p.current)
+	case ast.IndirectGotoStmt: // goto *addr may jump to any label of p.addrs
+		for name := range p.addrs {
+			p.reqLabel(name).useLabel(name, p.current)
+		}
 	case ast.CompoundStmt:
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "blockBody", stmt)
 	case ast.CaseStmt, ast.DefaultStmt:
 		p.markSwitchComplicated()
+	default:
+		p.markSetjmp(stmt, stmt)
 	}
 }
 
@@ -227,6 +242,7 @@ func (p *markCtx) markSwitchComplicated() {
 }
 
 func (p *markCtx) markSwitch(ctx *blockCtx, switchStmt *ast.Node) {
+	p.markSetjmp(switchStmt, switchStmt.Inner[0])
 	ret := p.enterOwner(switchStmt)
 	defer p.leaveOwner(ret)
 
@@ -247,6 +263,9 @@ func (p *markCtx) markSwitch(ctx *blockCtx, switchStmt *ast.Node) {
 		switch stmt.Kind {
 		case ast.CaseStmt:
 			idx = 1
+			if stmt.IsGNURange {
+				idx = 2
+			}
 		case ast.DefaultStmt:
 		default:
 			p.mark(ctx, stmt)
@@ -268,6 +287,24 @@ func (p *markCtx) markSwitch(ctx *blockCtx, switchStmt *ast.Node) {
 	return
 }
 
+// markAddrLabels numbers labels whose addresses are taken in node.
+func (p *markCtx) markAddrLabels(node *ast.Node) {
+	if node.Kind == ast.AddrLabelExpr {
+		if _, ok := p.addrs[node.Name]; !ok {
+			if p.addrs == nil {
+				p.addrs = make(map[string]int)
+			}
+			p.addrs[node.Name] = len(p.addrs)
+		}
+	}
+	for _, item := range node.Inner {
+		p.markAddrLabels(item)
+	}
+	for _, item := range node.ArrayFiller {
+		p.markAddrLabels(item)
+	}
+}
+
 func (p *markCtx) markEnd() {
 	for _, l := range p.labels {
 		for ref := range l.refs {
@@ -288,6 +325,10 @@ func (p *markCtx) markComplicated(stmt *ast.Node) {
 }
 
 func (p *blockCtx) markComplicated(name string, body *ast.Node) bool {
+	return p.markFuncBody(name, body).complicat
+}
+
+func (p *blockCtx) markFuncBody(name string, body *ast.Node) *markCtx {
 	if debugMarkComplicated {
 		start := time.Now()
 		defer func() {
@@ -296,9 +337,10 @@ func (p *blockCtx) markComplicated(name string, body *ast.Node) bool {
 	}
 	labels := make(map[string]*labelCtx)
 	marker := &markCtx{labels: labels}
+	marker.markAddrLabels(body)
 	marker.markBody(p, body)
 	marker.markEnd()
-	return marker.complicat
+	return marker
 }
 
 // -----------------------------------------------------------------------------
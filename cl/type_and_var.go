@@ -5,7 +5,7 @@ import (
 	"go/token"
 	"go/types"
 	"log"
-	"strconv"
+	"strings"
 
 	ctypes "github.com/weblfe/c2go/clang/types"
 
@@ -25,6 +25,7 @@ func toTypeEx(ctx *blockCtx, scope *types.Scope, tyAnonym types.Type, typ *ast.T
 	conf := &parser.Config{
 		Pkg: ctx.pkg.Types, Scope: scope, Flags: flags,
 		TyAnonym: tyAnonym, TyInt128: ctx.tyI128, TyUint128: ctx.tyU128,
+		TyLong: ctx.tyLong(), TyUlong: ctx.tyUlong(), TyWchar: ctx.target.Wchar(),
 	}
 retry:
 	t, kind, err := parser.ParseType(typ.QualType, conf)
@@ -33,13 +34,14 @@ retry:
 			ctx.typdecls[e.Literal] = ctx.cb.NewType(e.Literal)
 			goto retry
 		}
-		log.Panicln("toType:", err, "-", typ.QualType)
+		panicln(ErrInvalidType, "toType:", err, "-", typ.QualType)
 	}
 	return
 }
 
 func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node) (ret *types.Struct, dels delfunc) {
 	b := newStructBuilder()
+	b.layout = newRecordLayout(ctx, struc)
 	scope := types.NewScope(ctx.cb.Scope(), token.NoPos, token.NoPos, "")
 	n := len(struc.Inner)
 	for i := 0; i < n; i++ {
@@ -55,7 +57,7 @@ func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node) (ret *types.St
 				bits := toInt64(ctx, decl.Inner[0], "non-constant bit field")
 				b.BitField(ctx, typ, decl.Name, int(bits))
 			} else {
-				b.Field(ctx, ctx.goNodePos(decl), typ, decl.Name, false)
+				b.FieldWith(ctx, ctx.goNodePos(decl), typ, decl)
 			}
 		case ast.RecordDecl:
 			name, suKind := ctx.getSuName(decl, decl.TagUsed)
@@ -79,9 +81,11 @@ func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node) (ret *types.St
 				}
 				break
 			}
-		case ast.IndirectFieldDecl, ast.MaxFieldAlignmentAttr, ast.AlignedAttr, ast.PackedAttr:
+		case ast.AlignedAttr:
+			b.Align(ctx.attrAlign(decl))
+		case ast.IndirectFieldDecl, ast.MaxFieldAlignmentAttr, ast.PackedAttr: // see newRecordLayout
 		default:
-			log.Panicln("toStructType: unknown field kind =", decl.Kind)
+			panicln(ErrUnknownKind, "toStructType: unknown field kind =", decl.Kind)
 		}
 	}
 	ret = b.Type(ctx, t)
@@ -90,6 +94,7 @@ func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node) (ret *types.St
 
 func toUnionType(ctx *blockCtx, t *types.Named, unio *ast.Node) (ret types.Type, dels delfunc) {
 	b := newUnionBuilder()
+	b.layout = newRecordLayout(ctx, unio)
 	scope := types.NewScope(ctx.cb.Scope(), token.NoPos, token.NoPos, "")
 	n := len(unio.Inner)
 	for i := 0; i < n; i++ {
@@ -100,7 +105,7 @@ func toUnionType(ctx *blockCtx, t *types.Named, unio *ast.Node) (ret types.Type,
 				log.Println("  => field", decl.Name, "-", decl.Type.QualType)
 			}
 			typ, _ := toTypeEx(ctx, scope, nil, decl.Type, 0)
-			b.Field(ctx, ctx.goNodePos(decl), typ, decl.Name, false)
+			b.FieldWith(ctx, ctx.goNodePos(decl), typ, decl)
 		case ast.RecordDecl:
 			name, suKind := ctx.getSuName(decl, decl.TagUsed)
 			typ, del := compileStructOrUnion(ctx, name, decl)
@@ -123,9 +128,11 @@ func toUnionType(ctx *blockCtx, t *types.Named, unio *ast.Node) (ret types.Type,
 				}
 				break
 			}
-		case ast.IndirectFieldDecl, ast.MaxFieldAlignmentAttr, ast.AlignedAttr, ast.PackedAttr:
+		case ast.AlignedAttr:
+			b.Align(ctx.attrAlign(decl))
+		case ast.IndirectFieldDecl, ast.MaxFieldAlignmentAttr, ast.PackedAttr: // see newRecordLayout
 		default:
-			log.Panicln("toUnionType: unknown field kind =", decl.Kind)
+			panicln(ErrUnknownKind, "toUnionType: unknown field kind =", decl.Kind)
 		}
 	}
 	ret = b.Type(ctx, t)
@@ -166,6 +173,7 @@ func compileTypedef(ctx *blockCtx, decl *ast.Node, global bool) types.Type {
 					typ = ctypes.Int
 				} else if u, ok := ctx.unnameds[owned.ID]; ok {
 					typ = u.typ
+					ctx.nameRecord(typ, name)
 				} else {
 					log.Panicf("compileTypedef %v: unknown id = %v\n", name, owned.ID)
 				}
@@ -175,7 +183,10 @@ func compileTypedef(ctx *blockCtx, decl *ast.Node, global bool) types.Type {
 		}
 	}
 	typ := toType(ctx, decl.Type, parser.FlagIsTypedef)
-	if isArrayUnknownLen(typ) || typ == ctypes.Void {
+	if vla, ok := typ.(*ctypes.VLA); ok {
+		typ = newVLATypedef(ctx, scope, vla, decl)
+	}
+	if isArrayUnknownLen(typ) || isVLA(typ) || typ == ctypes.Void {
 		aliasType(scope, ctx.pkg.Types, name, typ)
 		return nil
 	}
@@ -202,13 +213,16 @@ func compileStructOrUnion(ctx *blockCtx, name string, decl *ast.Node) (*types.Na
 	if decl.CompleteDefinition {
 		var inner types.Type
 		var del delfunc
+		cnames := fieldNames(decl)
 		switch decl.TagUsed {
 		case "struct":
 			inner, del = toStructType(ctx, t.Type(), decl)
 		default:
 			inner, del = toUnionType(ctx, t.Type(), decl)
 		}
-		return t.InitType(ctx.pkg, inner), del
+		ret := t.InitType(ctx.pkg, inner)
+		ctx.addRecord(ret, decl, cnames)
+		return ret, del
 	}
 	return t.Type(), nil
 }
@@ -232,11 +246,11 @@ func compileEnumConst(ctx *blockCtx, cdecl *gox.ConstDefs, v *ast.Node, iotav in
 			compileExpr(ctx, v.Inner[0])
 			cval := cb.Get(-1).CVal
 			if cval == nil {
-				log.Panicln("compileEnumConst: not a constant expression")
+				panicln(ErrNotImpl, "compileEnumConst: not a constant expression")
 			}
 			ival, ok := constant.Int64Val(cval)
 			if !ok {
-				log.Panicln("compileEnumConst: not a integer constant")
+				panicln(ErrNotImpl, "compileEnumConst: not a integer constant")
 			}
 			iotav = int(ival)
 		} else {
@@ -270,13 +284,31 @@ func compileVarDecl(ctx *blockCtx, decl *ast.Node, global bool) {
 	}
 	typ, kind := toTypeEx(ctx, scope, nil, decl.Type, flags)
 	avoidKeyword(&decl.Name)
+	if vla, ok := typ.(*ctypes.VLA); ok {
+		if global || static != "" {
+			panicln(ErrNotImpl, "TODO: variable length array at file scope or static -", decl.Name)
+		}
+		newVLAVar(ctx, scope, vla, decl)
+		return
+	}
+	if !global && static == "" {
+		newVLAPtr(ctx, scope, decl)
+	}
 	if flags == parser.FlagIsExtern {
-		scope.Insert(types.NewVar(ctx.goNodePos(decl), ctx.pkg.Types, decl.Name, typ))
+		if align := ctx.overAlign(typ, decl); align > 0 {
+			newExternAlignedVar(ctx, scope, typ, decl)
+		} else {
+			scope.Insert(types.NewVar(ctx.goNodePos(decl), ctx.pkg.Types, decl.Name, typ))
+		}
 	} else {
 		if (kind&parser.KindFConst) != 0 && isInteger(typ) && tryNewConstInteger(ctx, typ, decl) {
 			return
 		}
-		newVarAndInit(ctx, scope, typ, decl, global)
+		if align := ctx.overAlign(typ, decl); align > 0 {
+			newAlignedVar(ctx, scope, typ, decl, align)
+		} else {
+			newVarAndInit(ctx, scope, typ, decl, global)
+		}
 		if static != "" {
 			substObj(ctx.pkg.Types, ctx.cb.Scope(), static, scope, decl.Name)
 		} else if kind == parser.KindFVolatile && !global {
@@ -293,7 +325,7 @@ func substObj(pkg *types.Package, scope *types.Scope, static string, scope2 *typ
 		if t, ok := old.Type().(*gox.SubstType); ok {
 			t.Real = real
 		} else {
-			log.Panicln(static, "redefined")
+			panicln(ErrNotImpl, "TODO: static", static, "redefined")
 		}
 	}
 }
@@ -332,15 +364,10 @@ func newVarAndInit(ctx *blockCtx, scope *types.Scope, typ types.Type, decl *ast.
 		log.Println("var", decl.Name, typ, "-", decl.Kind)
 	}
 	varDecl, inVBlock := ctx.newVar(scope, ctx.goNodePos(decl), typ, decl.Name)
-	inner := decl.Inner
-	if len(inner) == 1 && inner[0].Kind == ast.VisibilityAttr {
-		inner = inner[1:]
-	}
-	if len(inner) > 0 {
-		initExpr := inner[0]
+	if initExpr := varInitExpr(decl); initExpr != nil {
 		if ufs, ok := checkUnion(ctx, typ); ok {
 			if inVBlock {
-				log.Panicln("TODO: initUnionVar inVBlock")
+				panicln(ErrNotImpl, "TODO: initUnionVar inVBlock")
 			}
 			initUnionVar(ctx, decl.Name, ufs, initExpr)
 			return
@@ -363,6 +390,19 @@ func newVarAndInit(ctx *blockCtx, scope *types.Scope, typ types.Type, decl *ast.
 	}
 }
 
+// varInitExpr returns the initializer of a variable decl, or nil if it isn't
+// initialized. Attributes of decl follow its initializer.
+func varInitExpr(decl *ast.Node) *ast.Node {
+	if inner := decl.Inner; len(inner) > 0 && !isAttr(inner[0]) {
+		return inner[0]
+	}
+	return nil
+}
+
+func isAttr(v *ast.Node) bool {
+	return strings.HasSuffix(string(v.Kind), "Attr")
+}
+
 func hasFnPtrMember(typ types.Type) bool {
 retry:
 	switch t := typ.Underlying().(type) {
@@ -394,26 +434,21 @@ func varInit(ctx *blockCtx, typ types.Type, initExpr *ast.Node) {
 	}
 }
 
-func initLit(ctx *blockCtx, typ types.Type, initExpr *ast.Node) int {
+func initLit(ctx *blockCtx, typ types.Type, initExpr *ast.Node) {
 	switch t := typ.(type) {
 	case *types.Array:
 		if !initWithStringLiteral(ctx, typ, initExpr) {
 			arrayLit(ctx, t, initExpr)
 		}
 	case *types.Named:
-		structLit(ctx, t, initExpr)
-	case *bfType:
-		if initExpr.Kind != ast.ImplicitValueInitExpr {
-			log.Panicln("initLit bfType: TODO")
-		}
-		if !t.first {
-			return 0
+		if !isCompositeLit(t) { // eg. clang.Long in -neutral mode, clang.Int128
+			compileExpr(ctx, initExpr)
+			break
 		}
-		ctx.cb.ZeroLit(t.Type)
+		structLit(ctx, t, initExpr)
 	default:
 		compileExpr(ctx, initExpr)
 	}
-	return 1
 }
 
 func arrayLit(ctx *blockCtx, t *types.Array, decl *ast.Node) {
@@ -428,21 +463,113 @@ func arrayLit(ctx *blockCtx, t *types.Array, decl *ast.Node) {
 		inits = decl.Inner
 	}
 	elem := t.Elem()
-	for _, initExpr := range inits {
+	for i, initExpr := range inits {
+		if i > 0 && initExpr.ID == inits[i-1].ID && hasSideEffects(initExpr) {
+			// [lo ... hi] = v is expanded into v repeated hi-lo+1 times, but v
+			// should be evaluated only once
+			panicln(ErrNotImpl, "TODO: range designator initialized with side effects")
+		}
 		initLit(ctx, elem, initExpr)
 	}
 	ctx.cb.ArrayLit(t, len(inits))
 }
 
+// hasSideEffects checks if evaluating expr may have side effects.
+func hasSideEffects(expr *ast.Node) bool {
+	switch expr.Kind {
+	case ast.CallExpr, ast.CompoundAssignOperator, ast.StmtExpr:
+		return true
+	case ast.GenericSelectionExpr:
+		return hasSideEffects(selectedExpr(expr))
+	case ast.BinaryOperator:
+		if expr.OpCode == "=" {
+			return true
+		}
+	case ast.UnaryOperator:
+		if expr.OpCode == "++" || expr.OpCode == "--" {
+			return true
+		}
+	}
+	for _, item := range expr.Inner {
+		if hasSideEffects(item) {
+			return true
+		}
+	}
+	return false
+}
+
 func structLit(ctx *blockCtx, typ *types.Named, decl *ast.Node) {
+	if mfs, ok := ctx.getMisaligned(typ); ok && !mfs.flexibleOnly() {
+		misalignedLit(ctx, typ, decl)
+		return
+	}
 	t := ctx.getVStruct(typ)
-	n := 0
-	for i, initExpr := range decl.Inner {
-		n += initLit(ctx, t.Field(i).Type(), initExpr)
+	inits := decl.Inner
+	n, pads := 0, 0
+	for i, nf := 0, t.NumFields(); i < nf; i++ {
+		fld := t.Field(i)
+		if isPadding(fld) {
+			typedZeroLit(ctx, fld.Type())
+			n, pads = n+1, pads+1
+			continue
+		}
+		if i-pads >= len(inits) {
+			break
+		}
+		if bft, ok := fld.Type().(*bfType); ok {
+			if bft.first {
+				bitFieldsLit(ctx, t, i, inits[i-pads:])
+				n++
+			}
+			continue
+		}
+		initLit(ctx, fld.Type(), inits[i-pads])
+		n++
+	}
+	if nreal := t.NumFields() - pads; len(inits) > nreal { // flexible array members
+		for _, initExpr := range inits[nreal:] {
+			if initExpr.Kind != ast.ImplicitValueInitExpr {
+				panicln(ErrNotImpl, "TODO: initialize flexible array member of", typ)
+			}
+		}
 	}
 	ctx.cb.StructLit(typ, n, false)
 }
 
+// bitFieldsLit pushes value of the real field which holds bit fields starting
+// from t.Field(i), eg. (b & 1) | (c & 3) << 1. inits[0] is the initializer of
+// t.Field(i).
+func bitFieldsLit(ctx *blockCtx, t *types.Struct, i int, inits []*ast.Node) {
+	cb := ctx.cb
+	first := t.Field(i).Type().(*bfType)
+	n := 0
+	for j, initExpr := range inits {
+		bft, ok := t.Field(i + j).Type().(*bfType)
+		if !ok || bft.FldName != first.FldName {
+			break
+		}
+		if initExpr.Kind == ast.ImplicitValueInitExpr {
+			continue
+		}
+		compileExpr(ctx, initExpr)
+		typeCast(ctx, bft.Type, cb.Get(-1))
+		if bft.Bits < ctx.sizeof(bft.Type)<<3 {
+			cb.Val((1 << bft.Bits) - 1).BinaryOp(token.AND)
+		}
+		if bft.Off != 0 {
+			cb.Val(bft.Off).BinaryOp(token.SHL)
+			adjustIntConst(ctx, cb.Get(-1), bft.Type)
+		}
+		if n > 0 {
+			cb.BinaryOp(token.OR)
+		}
+		n++
+	}
+	if n == 0 {
+		cb.ZeroLit(first.Type)
+	}
+}
+
 func checkUnion(ctx *blockCtx, typ types.Type) (ufs *gox.UnionFields, is bool) {
 	if t, ok := typ.(*types.Named); ok {
 		if vft, ok := ctx.pkg.VFields(t); ok {
@@ -475,7 +602,7 @@ func initUnionVar(ctx *blockCtx, name string, ufs *gox.UnionFields, decl *ast.No
 			return
 		}
 	}
-	log.Panicln("initUnion: init with unexpect type -", t)
+	panicln(ErrNotImpl, "initUnion: init with unexpect type -", t)
 }
 
 const (
@@ -537,7 +664,7 @@ func isBool(typ types.Type) bool {
 }
 
 func isKind(typ types.Type, mask types.BasicInfo) bool {
-	if t, ok := typ.(*types.Basic); ok {
+	if t, ok := typ.Underlying().(*types.Basic); ok { // Basic or clang.Long, etc.
 		return (t.Info() & mask) != 0
 	}
 	return false
@@ -550,6 +677,11 @@ func isArrayUnknownLen(typ types.Type) bool {
 	return false
 }
 
+func isVLA(typ types.Type) bool {
+	_, ok := typ.(*ctypes.VLA)
+	return ok
+}
+
 func isFunc(typ types.Type) bool {
 	_, ok := typ.(*types.Signature)
 	return ok
@@ -566,22 +698,29 @@ func isCharArray(typ types.Type) bool {
 	return false
 }
 
+// isStringArray checks if an array of typ can be initialized by the string
+// literal lit, eg. char a[] = "...", wchar_t a[] = L"...".
+func isStringArray(typ types.Type, lit *ast.Node) bool {
+	if t, ok := typ.(*types.Array); ok {
+		if elem, ok := t.Elem().(*types.Basic); ok && elem.Info()&types.IsInteger != 0 {
+			return isCharArray(typ) == isNarrowString(lit)
+		}
+	}
+	return false
+}
+
 func initWithStringLiteral(ctx *blockCtx, typ types.Type, decl *ast.Node) bool {
-	if isCharArray(typ) {
-		switch decl.Kind {
-		case ast.InitListExpr:
-			inner := decl.Inner
-			if len(inner) != 1 || inner[0].Kind != ast.StringLiteral {
-				break
-			}
-			decl = inner[0]
-			fallthrough
-		case ast.StringLiteral:
-			s, err := strconv.Unquote(decl.Value.(string))
-			if err != nil {
-				log.Panicln("initWithStringLiteral:", err)
-			}
-			stringLit(ctx.cb, s, typ)
+	switch decl.Kind {
+	case ast.InitListExpr:
+		inner := decl.Inner
+		if len(inner) != 1 || inner[0].Kind != ast.StringLiteral {
+			break
+		}
+		decl = inner[0]
+		fallthrough
+	case ast.StringLiteral:
+		if isStringArray(typ, decl) {
+			stringLiteral(ctx, decl, typ)
 			return true
 		}
 	}
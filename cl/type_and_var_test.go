@@ -260,6 +260,29 @@ void test() {
 		x     float64
 	}
 	var a struct_foo = struct_foo{int32(1), 0, 0}
+}`)
+	testFunc(t, "testBFOpAssign", `
+void test() {
+	struct foo {
+		int a :3;
+		int b :2;
+	} a = {2, -1};
+	a.a += 1;
+	a.b--;
+}
+`, `func test() {
+	type struct_foo struct {
+		Xbf_0 int32
+	}
+	var a struct_foo = struct_foo{int32(2)&7 | 24}
+	{
+		_autoGo_1 := &a.Xbf_0
+		*_autoGo_1 = *_autoGo_1&^7 | (a.Xbf_0<<29>>29+int32(1))&7
+	}
+	{
+		_autoGo_2 := &a.Xbf_0
+		*_autoGo_2 = *_autoGo_2&^24 | (a.Xbf_0<<27>>30-int32(1))&3<<3
+	}
 }`)
 }
 
@@ -552,3 +575,49 @@ void test() {
 }
 
 // -----------------------------------------------------------------------------
+
+func TestTargetSizes(t *testing.T) {
+	cases := []struct {
+		triple string
+		size   int
+		offB   int
+		offP   int
+		long   types.Type
+		char   types.Type
+	}{
+		{"x86_64-linux-gnu", 24, 16, 8, types.Typ[types.Int64], types.Typ[types.Int8]},
+		{"i386-linux-gnu", 16, 8, 4, types.Typ[types.Int32], types.Typ[types.Int8]},
+		{"armv7-linux-gnueabihf", 16, 8, 4, types.Typ[types.Int32], types.Typ[types.Uint8]},
+		{"aarch64-linux-gnu", 24, 16, 8, types.Typ[types.Int64], types.Typ[types.Uint8]},
+		{"x86_64-pc-windows-msvc", 24, 16, 8, types.Typ[types.Int32], types.Typ[types.Int8]},
+	}
+	for _, c := range cases {
+		t.Run(c.triple, func(t *testing.T) {
+			target, err := ctypes.ParseTarget(c.triple)
+			if err != nil {
+				t.Fatal("ParseTarget:", err)
+			}
+			ctx := &blockCtx{}
+			ctx.initTarget(target)
+			foo := newStrucT(nil, newStruc(
+				"a", target.Char(),
+				"p", ctypes.UnsafePointer,
+				"b", types.Typ[types.Int64],
+			))
+			if size := ctx.sizeof(foo); size != c.size {
+				t.Fatal("sizeof:", size)
+			}
+			if off := ctx.offsetof(foo, "b"); off != c.offB {
+				t.Fatal("offsetof b:", off)
+			}
+			if off := ctx.offsetof(foo, "p"); off != c.offP {
+				t.Fatal("offsetof p:", off)
+			}
+			if target.Long() != c.long || target.Char() != c.char {
+				t.Fatal("long/char:", target.Long(), target.Char())
+			}
+		})
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,441 @@
+package cl
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/gox"
+	"github.com/weblfe/c2go/clang/ast"
+	"github.com/weblfe/c2go/clang/types/parser"
+
+	ctypes "github.com/weblfe/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// A variable length array (VLA) `T a[n][m]` is translated into a pointer to its
+// first element of a runtime sized Go slice:
+//
+//	var _cgo_vla_a_0 int = int(n)
+//	var _cgo_vla_a_1 int = int(m)
+//	var a *T = &make([]T, _cgo_vla_a_0*_cgo_vla_a_1)[0]
+//
+// A pointer to VLA is also translated into a pointer to the first element, so
+// a[i][j] is translated into *(a + i*_cgo_vla_a_1 + j) by pointer arithmetic,
+// and so is arithmetic of pointers to VLA (see compileVLAPtrArith).
+// As C, lengths of a VLA are evaluated only once where it is declared, and so
+// are lengths of VLA typedefs and pointers to VLA (including parameters). They
+// are saved in hidden locals (see saveVLA), which sizeof, subscripts and
+// pointer arithmetic of the object use. Declarations of VLA objects and pointers
+// to VLA are recorded, so that expressions which refer to them are known
+// without parsing their types (see vlaExprOf).
+
+// vlaObj is a declared VLA object, or a pointer to VLA if ptr is true. Lengths
+// of vla are the saved ones (see saveVLA).
+type vlaObj struct {
+	vla *ctypes.VLA
+	ptr bool
+}
+
+// vlaOf returns the VLA if x is a VLA object, eg. a and a[i] of `int a[n][m]`.
+func vlaOf(ctx *blockCtx, x *ast.Node) (*ctypes.VLA, bool) {
+	vla, ptr := ctx.vlaExprOf(x)
+	return vla, vla != nil && !ptr
+}
+
+// vlaPointee returns the VLA if x is a pointer to VLA, eg. p of `int (*p)[n]`.
+func vlaPointee(ctx *blockCtx, x *ast.Node) (*ctypes.VLA, bool) {
+	vla, ptr := ctx.vlaExprOf(x)
+	return vla, ptr
+}
+
+// vlaExprOf returns the VLA if x is a VLA object (ptr is false) or a pointer to
+// VLA. It's decided by the declaration which x refers to (see setVLA) rather
+// than the type of x, eg. a, a[i], *p and p+1 of `int a[n][m], (*p)[m]`. Casts
+// to pointers to VLA are exceptions, whose types are parsed.
+func (p *blockCtx) vlaExprOf(x *ast.Node) (vla *ctypes.VLA, ptr bool) {
+	switch x.Kind {
+	case ast.DeclRefExpr:
+		if decl := x.ReferencedDecl; decl != nil {
+			if obj, ok := p.vlas[decl.ID]; ok {
+				return obj.vla, obj.ptr
+			}
+		}
+	case ast.ParenExpr:
+		return p.vlaExprOf(x.Inner[0])
+	case ast.GenericSelectionExpr:
+		return p.vlaExprOf(selectedExpr(x))
+	case ast.ConditionalOperator:
+		return p.vlaExprOf(x.Inner[1])
+	case ast.ImplicitCastExpr, ast.CStyleCastExpr:
+		switch x.CastKind {
+		case ast.LValueToRValue, ast.NoOp:
+			return p.vlaExprOf(x.Inner[0])
+		case ast.ArrayToPointerDecay: // a => &a[0], a pointer to its first row
+			if vla, ptr = p.vlaExprOf(x.Inner[0]); vla != nil && !ptr {
+				if row, ok := vla.Elem.(*ctypes.VLA); ok {
+					return row, true
+				}
+			}
+		case ast.BitCast:
+			if x.Kind == ast.CStyleCastExpr { // (int (*)[n])p
+				if vla, ok := vlaPointeeType(p, x.Type); ok {
+					return vla, true
+				}
+			}
+		}
+	case ast.UnaryOperator:
+		vla, ptr = p.vlaExprOf(x.Inner[0])
+		switch x.OpCode {
+		case "*":
+			if ptr {
+				return vla, false
+			}
+		case "&":
+			if vla != nil && !ptr {
+				return vla, true
+			}
+		case "++", "--":
+			return
+		}
+	case ast.ArraySubscriptExpr: // p[i] or i[p]
+		for _, operand := range x.Inner {
+			if vla, ptr = p.vlaExprOf(operand); ptr {
+				return vla, false
+			}
+		}
+	case ast.BinaryOperator, ast.CompoundAssignOperator:
+		switch x.OpCode {
+		case "+", "-": // p+n, n+p, p-n, but not p-q
+			vla1, ptr1 := p.vlaExprOf(x.Inner[0])
+			vla2, ptr2 := p.vlaExprOf(x.Inner[1])
+			if ptr1 && !ptr2 {
+				return vla1, true
+			} else if ptr2 && !ptr1 && x.OpCode == "+" {
+				return vla2, true
+			}
+		case "=", "+=", "-=":
+			return p.vlaExprOf(x.Inner[0])
+		case ",":
+			return p.vlaExprOf(x.Inner[1])
+		}
+	}
+	return nil, false
+}
+
+// vlaPointeeType returns the VLA if typ is a pointer to VLA, eg. `int (*)[n]`.
+// It's only used by declarations and casts, since it parses typ.
+func vlaPointeeType(ctx *blockCtx, typ *ast.Type) (*ctypes.VLA, bool) {
+	if typ == nil || strings.Count(typ.QualType, "(*)") != 1 {
+		return nil, false
+	}
+	t := &ast.Type{QualType: strings.Replace(typ.QualType, "(*)", "", 1)}
+	vla, ok := toType(ctx, t, parser.FlagIsExtern).(*ctypes.VLA) // allow T[]
+	return vla, ok
+}
+
+// newVLAVar defines a local variable of VLA type.
+func newVLAVar(ctx *blockCtx, scope *types.Scope, vla *ctypes.VLA, decl *ast.Node) {
+	cb := ctx.cb
+	pos := ctx.goNodePos(decl)
+	vla = saveVLA(ctx, scope, vla, decl.Name, pos)
+	ctx.setVLA(decl.ID, vla, false)
+	elem := compileVLALen(ctx, vla)
+	n := cb.InternalStack().Pop()
+	cb.Val(ctx.pkg.Builtin().Ref("make")).Typ(types.NewSlice(elem)).Val(n).Call(2).
+		Val(0).IndexRef(1).UnaryOp(token.AND)
+	newLocalVar(ctx, scope, pos, ctypes.NewPointer(elem), decl.Name, cb.InternalStack().Pop())
+}
+
+// newVLAPtr saves lengths of the VLA which a local pointer (or parameter) decl
+// points to, if it is a pointer to VLA.
+func newVLAPtr(ctx *blockCtx, scope *types.Scope, decl *ast.Node) {
+	if vla, ok := vlaPointeeType(ctx, decl.Type); ok {
+		vla = saveVLA(ctx, scope, vla, decl.Name, ctx.goNodePos(decl))
+		markUsedVLA(ctx, scope, vla)
+		ctx.setVLA(decl.ID, vla, true)
+	}
+}
+
+// newVLATypedef saves lengths of a VLA typedef, and returns the VLA whose
+// lengths are the saved ones.
+func newVLATypedef(ctx *blockCtx, scope *types.Scope, vla *ctypes.VLA, decl *ast.Node) *ctypes.VLA {
+	vla = saveVLA(ctx, scope, vla, decl.Name, ctx.goNodePos(decl))
+	markUsedVLA(ctx, scope, vla)
+	return vla
+}
+
+// saveVLA evaluates lengths of vla which aren't constants into hidden locals
+// _cgo_vla_<name>_<i>, and returns the VLA whose lengths are these locals.
+func saveVLA(ctx *blockCtx, scope *types.Scope, vla *ctypes.VLA, name string, pos token.Pos) *ctypes.VLA {
+	var lens []string
+	var t types.Type = vla
+	for i := 0; ; i++ {
+		v, ok := t.(*ctypes.VLA)
+		if !ok {
+			break
+		}
+		n := v.Len
+		if _, err := strconv.ParseInt(n, 10, 64); err != nil {
+			compileArrayLen(ctx, n)
+			n = "_cgo_vla_" + name + "_" + strconv.Itoa(i)
+			newLocalVar(ctx, scope, pos, types.Typ[types.Int], n, ctx.cb.InternalStack().Pop())
+		}
+		lens, t = append(lens, n), v.Elem
+	}
+	for i := len(lens) - 1; i >= 0; i-- {
+		t = ctypes.NewVLA(t, lens[i])
+	}
+	return t.(*ctypes.VLA)
+}
+
+// markUsedVLA marks hidden locals of a saved VLA used (`_ = _cgo_vla_x_0`),
+// since a typedef or a pointer may not be used.
+func markUsedVLA(ctx *blockCtx, scope *types.Scope, vla *ctypes.VLA) {
+	_, lens := vla.Base()
+	for _, n := range lens {
+		if strings.HasPrefix(n, "_cgo_vla_") {
+			ctx.cb.VarRef(nil).Val(gox.Lookup(scope, n)).Assign(1)
+		}
+	}
+}
+
+// newLocalVar defines a local variable name of typ, initialized by v.
+func newLocalVar(ctx *blockCtx, scope *types.Scope, pos token.Pos, typ types.Type, name string, v *gox.Element) {
+	cb := ctx.cb
+	varDecl, inVBlock := ctx.newVar(scope, pos, typ, name)
+	if inVBlock {
+		cb.VarRef(gox.Lookup(scope, name)).Val(v).Assign(1)
+	} else {
+		varDecl.InitStart(ctx.pkg).Val(v).EndInit(1)
+	}
+}
+
+// setVLA records the declaration id of a VLA object, or a pointer to VLA if ptr
+// is true. See vlaExprOf.
+func (p *blockCtx) setVLA(id ast.ID, vla *ctypes.VLA, ptr bool) {
+	if p.vlas == nil {
+		p.vlas = make(map[ast.ID]vlaObj)
+	}
+	p.vlas[id] = vlaObj{vla: vla, ptr: ptr}
+}
+
+// compileVLALen pushes int(N1)*int(N2)*..., the number of base elements of a
+// VLA, and returns the base element type.
+func compileVLALen(ctx *blockCtx, vla *ctypes.VLA) types.Type {
+	elem, lens := vla.Base()
+	for i, expr := range lens {
+		compileArrayLen(ctx, expr)
+		if i > 0 {
+			ctx.cb.BinaryOp(token.MUL)
+		}
+	}
+	return elem
+}
+
+// compileVLASizeof pushes sizeof of a VLA, that is size_t(n) * sizeof(T).
+func compileVLASizeof(ctx *blockCtx, vla *ctypes.VLA, v *ast.Node) {
+	cb := ctx.cb
+	t := toType(ctx, v.Type, 0)
+	elem := compileVLALen(ctx, vla)
+	n := cb.InternalStack().Pop()
+	cb.Typ(t).Val(n).Call(1)
+	if ctx.isNeutralSize(elem) {
+		cb.Typ(t)
+		ctx.unsafeSizeof(elem)
+		cb.Call(1)
+	} else {
+		cb.Val(ctx.sizeof(elem))
+	}
+	cb.BinaryOp(token.MUL)
+}
+
+// compileVLASubscript compiles p[i] whose value is a VLA (a row of a multi
+// dimensional VLA), that is p + i*n where n is number of base elements of the
+// row.
+func compileVLASubscript(ctx *blockCtx, vla *ctypes.VLA, v *ast.Node) {
+	cb := ctx.cb
+	compileExpr(ctx, v.Inner[0])
+	compileExpr(ctx, v.Inner[1])
+	castInt(ctx)
+	compileVLALen(ctx, vla)
+	cb.BinaryOp(token.MUL)
+	binaryOp(ctx, token.ADD, v)
+}
+
+// compileVLAPtrArith compiles p+n, n+p, p-n and p-q, where p and q are pointers
+// to VLA, that is p + n*len and (p - q) / len where len is number of base
+// elements of the VLA. It returns false if v isn't any of them.
+func compileVLAPtrArith(ctx *blockCtx, op token.Token, v *ast.Node) bool {
+	if op != token.ADD && op != token.SUB {
+		return false
+	}
+	x, y := v.Inner[0], v.Inner[1]
+	vla, ok := vlaPointee(ctx, x)
+	if !ok {
+		if vla, ok = vlaPointee(ctx, y); !ok || op != token.ADD {
+			return false
+		}
+		x, y = y, x // n+p => p+n
+	}
+	cb := ctx.cb
+	compileExpr(ctx, x)
+	compileExpr(ctx, y)
+	if _, ok := vlaPointee(ctx, y); ok { // p-q
+		binaryOp(ctx, op, v)
+		cb.Typ(cb.Get(-1).Type)
+		compileVLALen(ctx, vla)
+		cb.Call(1).BinaryOp(token.QUO)
+		return true
+	}
+	mulVLALen(ctx, x)
+	binaryOp(ctx, op, v)
+	return true
+}
+
+// mulVLALen multiplies the top of the stack (n of p+n, p+=n, etc.) by number of
+// base elements of the VLA which p points to, if p is a pointer to VLA.
+func mulVLALen(ctx *blockCtx, p *ast.Node) {
+	if vla, ok := vlaPointee(ctx, p); ok {
+		castInt(ctx)
+		compileVLALen(ctx, vla)
+		ctx.cb.BinaryOp(token.MUL)
+	}
+}
+
+// compileVLAStride pushes uintptr(len) * sizeof(T), the size of the VLA which p
+// points to, eg. the step of p++.
+func compileVLAStride(ctx *blockCtx, vla *ctypes.VLA, p *ast.Node) {
+	cb := ctx.cb
+	elem := compileVLALen(ctx, vla)
+	n := cb.InternalStack().Pop()
+	cb.Typ(tyUintptr).Val(n).Call(1)
+	ctx.mulSizeof(elem)
+}
+
+// compileArrayLen pushes int(expr), where expr is the length expression of a
+// VLA in C, eg. `n * 2`, `p->n + 1`, `strlen(s) + 1`. Clang doesn't dump length
+// expressions of VLA variables, so expr is the text in their types and parsed
+// as Go. Only expressions which mean the same in C and Go are allowed, others
+// (eg. casts, sizeof, char literals, `!`, `?:` and `n << 1 + 1`) are reported
+// as ErrNotImpl.
+func compileArrayLen(ctx *blockCtx, expr string) {
+	goexpr := intSuffix.ReplaceAllString(strings.ReplaceAll(expr, "->", "."), "$1")
+	e, err := goparser.ParseExpr(goexpr)
+	if err != nil {
+		panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+	}
+	compileLenExpr(ctx, e, expr)
+	castInt(ctx)
+}
+
+// intSuffix matches integer literals with suffixes, eg. 10UL.
+var intSuffix = regexp.MustCompile(`\b(0[xX][0-9a-fA-F]+|[0-9]+)[uUlL]+\b`)
+
+func compileLenExpr(ctx *blockCtx, e goast.Expr, expr string) {
+	cb := ctx.cb
+	switch v := e.(type) {
+	case *goast.Ident:
+		switch lookupLenObj(ctx, v, expr).(type) {
+		case *types.Var, *types.Const:
+		default:
+			panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+		}
+	case *goast.BasicLit:
+		if v.Kind != token.INT { // 'a' and 1.5 are different in Go
+			panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+		}
+		cb.Val(v)
+	case *goast.ParenExpr:
+		compileLenExpr(ctx, v.X, expr)
+	case *goast.SelectorExpr:
+		compileLenExpr(ctx, v.X, expr)
+		cb.MemberVal(v.Sel.Name)
+	case *goast.CallExpr:
+		fn, ok := v.Fun.(*goast.Ident) // not a cast, eg. (int)(n)
+		if !ok {
+			panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+		}
+		if _, ok = lookupLenObj(ctx, fn, expr).Type().(*types.Signature); !ok {
+			panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+		}
+		for _, arg := range v.Args {
+			compileLenExpr(ctx, arg, expr)
+		}
+		cb.Call(len(v.Args))
+	case *goast.UnaryExpr:
+		if v.Op != token.ADD && v.Op != token.SUB {
+			panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+		}
+		compileLenExpr(ctx, v.X, expr)
+		castInt(ctx)
+		cb.UnaryOp(v.Op)
+	case *goast.BinaryExpr:
+		switch v.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO, token.REM,
+			token.SHL, token.SHR, token.AND, token.OR, token.XOR:
+		default:
+			panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+		}
+		if !samePrecedence(v, v.X) || !samePrecedence(v, v.Y) {
+			panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+		}
+		compileLenExpr(ctx, v.X, expr)
+		castInt(ctx)
+		compileLenExpr(ctx, v.Y, expr)
+		castInt(ctx)
+		cb.BinaryOp(v.Op)
+	default:
+		panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+	}
+}
+
+// lookupLenObj pushes the object which ident of a VLA length refers to, and
+// returns it.
+func lookupLenObj(ctx *blockCtx, ident *goast.Ident, expr string) types.Object {
+	name := ident.Name
+	if !ctx.getPubName(&name) {
+		avoidKeyword(&name)
+	}
+	obj := ctx.lookupParent(name)
+	if obj == nil {
+		panicln(ErrNotImpl, "TODO: length of variable length array -", expr)
+	}
+	ctx.cb.Val(obj)
+	return obj
+}
+
+// samePrecedence reports whether C and Go parse the binary expression v and its
+// operand x in the same way. They differ when shift and bitwise operators are
+// mixed with other operators, eg. `n << 1 + 1` is `n << (1 + 1)` in C.
+func samePrecedence(v *goast.BinaryExpr, x goast.Expr) bool {
+	y, ok := x.(*goast.BinaryExpr)
+	if !ok || y.Op == v.Op {
+		return true
+	}
+	return !isBitOp(v.Op) && !isBitOp(y.Op)
+}
+
+func isBitOp(op token.Token) bool {
+	switch op {
+	case token.SHL, token.SHR, token.AND, token.OR, token.XOR:
+		return true
+	}
+	return false
+}
+
+// castInt converts the top of the stack into int unless it is untyped.
+func castInt(ctx *blockCtx) {
+	cb := ctx.cb
+	if v := cb.Get(-1); v.Type != types.Typ[types.Int] && !isUntyped(v.Type) {
+		v = cb.InternalStack().Pop()
+		cb.Typ(types.Typ[types.Int]).Val(v).Call(1)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,154 @@
+package cl
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gox"
+	"github.com/weblfe/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+// newVLAFunc returns AST of `void f(int n) { int a[expr]; }`.
+func newVLAFunc(expr string) *ast.Node {
+	param := newTestNode(ast.ParmVarDecl, "int")
+	param.Name = "n"
+	a := newTestNode(ast.VarDecl, "int["+expr+"]")
+	a.Name = "a"
+	body := newTestNode(ast.CompoundStmt, "", newTestNode(ast.DeclStmt, "", a))
+	fn := newTestNode(ast.FunctionDecl, "void (int)", param, body)
+	fn.Name = "f"
+	return newTestNode(ast.TranslationUnitDecl, "", fn)
+}
+
+func TestVLALen(t *testing.T) {
+	for _, c := range []struct {
+		len, want string
+	}{
+		{"n", "_cgo_vla_a_0 int = int(n)"},
+		{"n * 2 + 1", "_cgo_vla_a_0 int = int(n)*2 + 1"},
+		{"(n << 1) + 1", "_cgo_vla_a_0 int = int(n)<<1 + 1"},
+		{"n & 3 & 1", "_cgo_vla_a_0 int = int(n) & 3 & 1"},
+		{"-n + 10UL", "_cgo_vla_a_0 int = -int(n) + 10"},
+	} {
+		pkg, err := NewPackage("", "foo", newVLAFunc(c.len), &Config{Src: []byte(" ")})
+		if err != nil {
+			t.Fatal("NewPackage:", c.len, err)
+		}
+		var b bytes.Buffer
+		format.Node(&b, pkg.Fset, gox.ASTFile(pkg.Package))
+		if out := b.String(); !strings.Contains(out, c.want) {
+			t.Fatalf("%s: %s not found:\n%s", c.len, c.want, out)
+		}
+	}
+}
+
+// TestVLALenNotImpl checks lengths which can't be parsed as Go, or mean
+// differently in Go.
+func TestVLALenNotImpl(t *testing.T) {
+	for _, expr := range []string{
+		"(int)n",
+		"(int)(n)",
+		"(unsigned long)n + 1",
+		"sizeof (n) * n",
+		"sizeof n * n",
+		"!n + 1",
+		"n ? n : 1",
+		"n + 'a'",
+		"n + '\\0'",
+		"n * 1.5",
+		"n << 1 + 1",
+		"n & 3 + 1",
+		"n | n * 2",
+		"m[0] + n",
+		"m[n][0]",
+		"&n",
+		"int",
+	} {
+		_, err := NewPackage("", "foo", newVLAFunc(expr), &Config{Src: []byte(" ")})
+		errs, ok := err.(ErrorList)
+		if !ok || len(errs) != 1 || errs[0].Code != ErrNotImpl {
+			t.Fatal("NewPackage:", expr, err)
+		}
+		if msg := errs[0].Msg; msg != "TODO: length of variable length array - "+expr {
+			t.Fatal("NewPackage:", expr, msg)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// TestVLAObjects checks that VLA objects and pointers to VLA are known by their
+// declarations, and their saved lengths are used.
+func TestVLAObjects(t *testing.T) {
+	ref := func(decl *ast.Node) *ast.Node {
+		v := newTestNode(ast.DeclRefExpr, decl.Type.QualType)
+		v.ReferencedDecl = &ast.Node{ID: decl.ID, Name: decl.Name, Kind: decl.Kind}
+		return v
+	}
+	newDecl := func(kind ast.Kind, id ast.ID, name, typ string, init ...*ast.Node) *ast.Node {
+		v := newTestNode(kind, typ, init...)
+		v.ID, v.Name = id, name
+		if len(init) > 0 {
+			v.Init = "c"
+		}
+		return v
+	}
+	op := func(kind ast.Kind, op, typ string, x, y *ast.Node) *ast.Node {
+		v := newTestNode(kind, typ, x, y)
+		v.OpCode = ast.OpCode(op)
+		return v
+	}
+	intLit := func(val string) *ast.Node {
+		v := newTestNode(ast.IntegerLiteral, "int")
+		v.Value = val
+		return v
+	}
+	// void f(int n, int m) {
+	//	int a[n][m];
+	//	int (*row)[m] = a;
+	//	a[1][2] = 3;
+	//	row = row + 1;
+	//	unsigned long k = sizeof(*row);
+	// }
+	n := newDecl(ast.ParmVarDecl, "0x1", "n", "int")
+	m := newDecl(ast.ParmVarDecl, "0x2", "m", "int")
+	a := newDecl(ast.VarDecl, "0x3", "a", "int[n][m]")
+	row := newDecl(ast.VarDecl, "0x4", "row", "int (*)[m]",
+		testCast(ast.ArrayToPointerDecay, "int (*)[m]", ref(a)))
+	a1 := newTestNode(ast.ArraySubscriptExpr, "int[m]", testCast(ast.ArrayToPointerDecay, "int (*)[m]", ref(a)), intLit("1"))
+	a12 := newTestNode(ast.ArraySubscriptExpr, "int", testCast(ast.ArrayToPointerDecay, "int *", a1), intLit("2"))
+	rowVal := testCast(ast.LValueToRValue, "int (*)[m]", ref(row))
+	deref := newTestNode(ast.UnaryOperator, "int[m]", rowVal)
+	deref.OpCode = "*"
+	sizeof := newTestNode(ast.UnaryExprOrTypeTraitExpr, "unsigned long", newTestNode(ast.ParenExpr, "int[m]", deref))
+	sizeof.Name = "sizeof"
+	body := newTestNode(ast.CompoundStmt, "",
+		newTestNode(ast.DeclStmt, "", a),
+		newTestNode(ast.DeclStmt, "", row),
+		op(ast.BinaryOperator, "=", "int", a12, intLit("3")),
+		op(ast.BinaryOperator, "=", "int (*)[m]", ref(row), op(ast.BinaryOperator, "+", "int (*)[m]", rowVal, intLit("1"))),
+		newTestNode(ast.DeclStmt, "", newDecl(ast.VarDecl, "0x5", "k", "unsigned long", sizeof)))
+	fn := newDecl(ast.FunctionDecl, "0x6", "f", "void (int, int)", n, m, body)
+	doc := newTestNode(ast.TranslationUnitDecl, "", fn)
+
+	pkg, err := NewPackage("", "foo", doc, &Config{Src: []byte(" ")})
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	var b bytes.Buffer
+	format.Node(&b, pkg.Fset, gox.ASTFile(pkg.Package))
+	out := b.String()
+	for _, s := range []string{
+		"uintptr(unsafe.Pointer(a))+uintptr(int(int32(1))*_cgo_vla_a_1)*4)))) + uintptr(int32(2))*4)) = int32(3)",
+		"row = (*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(row)) + uintptr(int(int32(1))*_cgo_vla_row_0)*4))",
+		"var k uint64 = uint64(_cgo_vla_row_0) * 4",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("%s not found:\n%s", s, out)
+		}
+	}
+}
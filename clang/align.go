@@ -0,0 +1,22 @@
+package clang
+
+import (
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+// AlignedAlloc allocates a zeroed memory block of size bytes, whose address is
+// a multiple of align. It is used by over-aligned variables, eg. `_Alignas(32)
+// char buf[64]`, since Go doesn't align a variable more than its type needs.
+// The block isn't scanned by GC, so it must not hold Go pointers.
+func AlignedAlloc(size, align uintptr) unsafe.Pointer {
+	buf := make([]byte, size+align-1)
+	off := uintptr(unsafe.Pointer(&buf[0])) & (align - 1)
+	if off != 0 {
+		off = align - off
+	}
+	return unsafe.Pointer(&buf[off])
+}
+
+// -----------------------------------------------------------------------------
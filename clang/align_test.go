@@ -0,0 +1,26 @@
+package clang
+
+import (
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestAlignedAlloc(t *testing.T) {
+	for _, align := range []uintptr{2, 16, 64, 4096} {
+		for _, size := range []uintptr{0, 1, 24, 100} {
+			p := AlignedAlloc(size, align)
+			if uintptr(p)%align != 0 {
+				t.Fatal("AlignedAlloc:", size, align, p)
+			}
+			buf := (*[128]byte)(p)
+			for i := uintptr(0); i < size; i++ {
+				if buf[i] != 0 {
+					t.Fatal("AlignedAlloc: not zeroed -", size, align)
+				}
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
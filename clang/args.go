@@ -0,0 +1,19 @@
+package clang
+
+// -----------------------------------------------------------------------------
+
+// CStrings converts strs into a NULL terminated array of C strings. It is used
+// to pass argv and envp to main of C, eg. CStrings(os.Args).
+func CStrings(strs []string) **Char {
+	ptrs := make([]*Char, len(strs)+1)
+	for i, s := range strs {
+		b := make([]Char, len(s)+1)
+		for j := 0; j < len(s); j++ {
+			b[j] = Char(s[j])
+		}
+		ptrs[i] = &b[0]
+	}
+	return &ptrs[0]
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,32 @@
+package clang
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+func goString(p *Char) string {
+	var b []byte
+	for ; *p != 0; p = (*Char)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + 1)) {
+		b = append(b, byte(*p))
+	}
+	return string(b)
+}
+
+func TestCStrings(t *testing.T) {
+	strs := []string{"prog", "", "-x=\xff"}
+	argv := CStrings(strs)
+	ptrs := (*[4]*Char)(unsafe.Pointer(argv))
+	for i, s := range strs {
+		if v := goString(ptrs[i]); v != s {
+			t.Fatalf("argv[%d] = %q, want %q", i, v, s)
+		}
+	}
+	if ptrs[3] != nil {
+		t.Fatal("argv not NULL terminated")
+	}
+}
+
+// -----------------------------------------------------------------------------
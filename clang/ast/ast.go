@@ -52,6 +52,7 @@ const (
 	IndirectFieldDecl        Kind = "IndirectFieldDecl"
 	VarDecl                  Kind = "VarDecl"
 	EmptyDecl                Kind = "EmptyDecl"
+	StaticAssertDecl         Kind = "StaticAssertDecl"
 	EnumDecl                 Kind = "EnumDecl"
 	EnumConstantDecl         Kind = "EnumConstantDecl"
 	AlwaysInlineAttr         Kind = "AlwaysInlineAttr"
@@ -90,6 +91,7 @@ const (
 	WhileStmt                Kind = "WhileStmt"
 	DoStmt                   Kind = "DoStmt"
 	GotoStmt                 Kind = "GotoStmt"
+	IndirectGotoStmt         Kind = "IndirectGotoStmt"
 	BreakStmt                Kind = "BreakStmt"
 	ContinueStmt             Kind = "ContinueStmt"
 	LabelStmt                Kind = "LabelStmt"
@@ -100,9 +102,13 @@ const (
 	ReturnStmt               Kind = "ReturnStmt"
 	GCCAsmStmt               Kind = "GCCAsmStmt"
 	ParenExpr                Kind = "ParenExpr"
+	GenericSelectionExpr     Kind = "GenericSelectionExpr"
+	StmtExpr                 Kind = "StmtExpr"
+	AddrLabelExpr            Kind = "AddrLabelExpr"
 	CallExpr                 Kind = "CallExpr"
 	ConstantExpr             Kind = "ConstantExpr"
 	InitListExpr             Kind = "InitListExpr"
+	CompoundLiteralExpr      Kind = "CompoundLiteralExpr"
 	CStyleCastExpr           Kind = "CStyleCastExpr"
 	DeclRefExpr              Kind = "DeclRefExpr"
 	MemberExpr               Kind = "MemberExpr"
@@ -208,12 +214,15 @@ type Node struct {
 	StorageClass         StorageClass  `json:"storageClass,omitempty"`
 	TagUsed              string        `json:"tagUsed,omitempty"` // struct | union
 	HasElse              bool          `json:"hasElse,omitempty"`
+	IsGNURange           bool          `json:"isGNURange,omitempty"` // is `case lo ... hi:`
+	Selected             bool          `json:"selected,omitempty"`   // is the association selected by _Generic
 	CompleteDefinition   bool          `json:"completeDefinition,omitempty"`
 	Complicated          bool          `json:"-"` // complicated statement
 	Variadic             bool          `json:"variadic,omitempty"`
 	Name                 string        `json:"name,omitempty"`
 	MangledName          string        `json:"mangledName,omitempty"`
 	Type                 *Type         `json:"type,omitempty"`
+	ArgType              *Type         `json:"argType,omitempty"` // type operand of sizeof/alignof
 	CC                   CC            `json:"cc,omitempty"`
 	Decl                 *Node         `json:"decl,omitempty"`
 	OwnedTagDecl         *Node         `json:"ownedTagDecl,omitempty"`
@@ -1,5 +1,6 @@
-//go:build 386
-// +build 386
+//go:build (386 || arm || mips || mipsle) && !windows
+// +build 386 arm mips mipsle
+// +build !windows
 
 package clang
 
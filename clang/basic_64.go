@@ -1,5 +1,6 @@
-//go:build amd64
-// +build amd64
+//go:build (amd64 || arm64 || riscv64 || ppc64 || ppc64le || mips64 || mips64le || s390x || wasm) && !windows
+// +build amd64 arm64 riscv64 ppc64 ppc64le mips64 mips64le s390x wasm
+// +build !windows
 
 package clang
 
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package clang
+
+// Windows is LLP64, where long is 32 bits on all archs.
+
+type Long = int32
+type Ulong = uint32
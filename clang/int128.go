@@ -0,0 +1,319 @@
+package clang
+
+import (
+	"math"
+	"math/bits"
+)
+
+// -----------------------------------------------------------------------------
+
+// Int128 is the Go type of __int128. It is a two's complement integer.
+//
+// C operators on Int128 are Gop_xxx methods, so that c2go can translate them
+// as operators on builtin types.
+type Int128 struct {
+	Lo, Hi uint64
+}
+
+// Uint128 is the Go type of unsigned __int128.
+type Uint128 struct {
+	Lo, Hi uint64
+}
+
+const two64 = 1 << 64
+
+// -----------------------------------------------------------------------------
+
+// Uint128FromUint64 converts an uint64 to Uint128.
+func Uint128FromUint64(v uint64) Uint128 {
+	return Uint128{Lo: v}
+}
+
+// Uint128FromInt64 converts an int64 to Uint128 (sign extended).
+func Uint128FromInt64(v int64) Uint128 {
+	return Uint128(Int128FromInt64(v))
+}
+
+// Uint128FromFloat64 converts a float64 to Uint128 (truncated).
+func Uint128FromFloat64(v float64) Uint128 {
+	if v < 1 {
+		return Uint128{}
+	}
+	if v >= two64 {
+		hi := math.Floor(v / two64)
+		return Uint128{Lo: uint64(v - hi*two64), Hi: uint64(hi)}
+	}
+	return Uint128{Lo: uint64(v)}
+}
+
+// Uint64 converts a to uint64 (truncated).
+func (a Uint128) Uint64() uint64 {
+	return a.Lo
+}
+
+// Int64 converts a to int64 (truncated).
+func (a Uint128) Int64() int64 {
+	return int64(a.Lo)
+}
+
+// Float64 converts a to float64.
+func (a Uint128) Float64() float64 {
+	return float64(a.Hi)*two64 + float64(a.Lo)
+}
+
+func (a Uint128) cmp(b Uint128) int {
+	switch {
+	case a.Hi < b.Hi:
+		return -1
+	case a.Hi > b.Hi:
+		return 1
+	case a.Lo < b.Lo:
+		return -1
+	case a.Lo > b.Lo:
+		return 1
+	}
+	return 0
+}
+
+func (a Uint128) Gop_Add(b Uint128) Uint128 {
+	lo, carry := bits.Add64(a.Lo, b.Lo, 0)
+	hi, _ := bits.Add64(a.Hi, b.Hi, carry)
+	return Uint128{lo, hi}
+}
+
+func (a Uint128) Gop_Sub(b Uint128) Uint128 {
+	lo, borrow := bits.Sub64(a.Lo, b.Lo, 0)
+	hi, _ := bits.Sub64(a.Hi, b.Hi, borrow)
+	return Uint128{lo, hi}
+}
+
+func (a Uint128) Gop_Mul(b Uint128) Uint128 {
+	hi, lo := bits.Mul64(a.Lo, b.Lo)
+	hi += a.Hi*b.Lo + a.Lo*b.Hi
+	return Uint128{lo, hi}
+}
+
+func (a Uint128) quoRem(b Uint128) (q, r Uint128) {
+	if b.Hi == 0 {
+		if a.Hi < b.Lo {
+			q.Lo, r.Lo = bits.Div64(a.Hi, a.Lo, b.Lo)
+			return
+		}
+		q.Hi, r.Lo = a.Hi/b.Lo, a.Hi%b.Lo
+		q.Lo, r.Lo = bits.Div64(r.Lo, a.Lo, b.Lo)
+		return
+	}
+	// estimate the quotient by the highest 64 bits of b, it is q or q+1
+	n := uint(bits.LeadingZeros64(b.Hi))
+	v := b.Gop_Lsh(n)
+	u := a.Gop_Rsh(1)
+	tq, _ := bits.Div64(u.Hi, u.Lo, v.Hi)
+	tq >>= 63 - n
+	if tq != 0 {
+		tq--
+	}
+	q = Uint128{Lo: tq}
+	r = a.Gop_Sub(b.Gop_Mul(q))
+	if r.cmp(b) >= 0 {
+		q = q.Gop_Add(Uint128{Lo: 1})
+		r = r.Gop_Sub(b)
+	}
+	return
+}
+
+func (a Uint128) Gop_Quo(b Uint128) Uint128 {
+	q, _ := a.quoRem(b)
+	return q
+}
+
+func (a Uint128) Gop_Rem(b Uint128) Uint128 {
+	_, r := a.quoRem(b)
+	return r
+}
+
+func (a Uint128) Gop_And(b Uint128) Uint128 {
+	return Uint128{a.Lo & b.Lo, a.Hi & b.Hi}
+}
+
+func (a Uint128) Gop_Or(b Uint128) Uint128 {
+	return Uint128{a.Lo | b.Lo, a.Hi | b.Hi}
+}
+
+func (a Uint128) Gop_Xor(b Uint128) Uint128 {
+	return Uint128{a.Lo ^ b.Lo, a.Hi ^ b.Hi}
+}
+
+func (a Uint128) Gop_Lsh(n uint) Uint128 {
+	if n >= 64 {
+		return Uint128{0, a.Lo << (n - 64)}
+	}
+	return Uint128{a.Lo << n, a.Hi<<n | a.Lo>>(64-n)}
+}
+
+func (a Uint128) Gop_Rsh(n uint) Uint128 {
+	if n >= 64 {
+		return Uint128{a.Hi >> (n - 64), 0}
+	}
+	return Uint128{a.Lo>>n | a.Hi<<(64-n), a.Hi >> n}
+}
+
+func (a Uint128) Gop_LT(b Uint128) bool { return a.cmp(b) < 0 }
+func (a Uint128) Gop_LE(b Uint128) bool { return a.cmp(b) <= 0 }
+func (a Uint128) Gop_GT(b Uint128) bool { return a.cmp(b) > 0 }
+func (a Uint128) Gop_GE(b Uint128) bool { return a.cmp(b) >= 0 }
+
+func (a Uint128) Gop_Neg() Uint128 { return Uint128{}.Gop_Sub(a) }
+func (a Uint128) Gop_Not() Uint128 { return Uint128{^a.Lo, ^a.Hi} }
+func (a Uint128) Gop_Dup() Uint128 { return a }
+
+func (a *Uint128) Gop_AddAssign(b Uint128) { *a = a.Gop_Add(b) }
+func (a *Uint128) Gop_SubAssign(b Uint128) { *a = a.Gop_Sub(b) }
+func (a *Uint128) Gop_MulAssign(b Uint128) { *a = a.Gop_Mul(b) }
+func (a *Uint128) Gop_QuoAssign(b Uint128) { *a = a.Gop_Quo(b) }
+func (a *Uint128) Gop_RemAssign(b Uint128) { *a = a.Gop_Rem(b) }
+func (a *Uint128) Gop_AndAssign(b Uint128) { *a = a.Gop_And(b) }
+func (a *Uint128) Gop_OrAssign(b Uint128)  { *a = a.Gop_Or(b) }
+func (a *Uint128) Gop_XorAssign(b Uint128) { *a = a.Gop_Xor(b) }
+func (a *Uint128) Gop_LshAssign(n uint)    { *a = a.Gop_Lsh(n) }
+func (a *Uint128) Gop_RshAssign(n uint)    { *a = a.Gop_Rsh(n) }
+
+func (a *Uint128) Gop_Inc() { *a = a.Gop_Add(Uint128{Lo: 1}) }
+func (a *Uint128) Gop_Dec() { *a = a.Gop_Sub(Uint128{Lo: 1}) }
+
+// -----------------------------------------------------------------------------
+
+// Int128FromInt64 converts an int64 to Int128.
+func Int128FromInt64(v int64) Int128 {
+	return Int128{Lo: uint64(v), Hi: uint64(v >> 63)}
+}
+
+// Int128FromUint64 converts an uint64 to Int128.
+func Int128FromUint64(v uint64) Int128 {
+	return Int128{Lo: v}
+}
+
+// Int128FromFloat64 converts a float64 to Int128 (truncated).
+func Int128FromFloat64(v float64) Int128 {
+	if v < 0 {
+		return Int128(Uint128FromFloat64(-v)).Gop_Neg()
+	}
+	return Int128(Uint128FromFloat64(v))
+}
+
+// Uint64 converts a to uint64 (truncated).
+func (a Int128) Uint64() uint64 {
+	return a.Lo
+}
+
+// Int64 converts a to int64 (truncated).
+func (a Int128) Int64() int64 {
+	return int64(a.Lo)
+}
+
+// Float64 converts a to float64.
+func (a Int128) Float64() float64 {
+	if a.neg() {
+		return -Uint128(a.Gop_Neg()).Float64()
+	}
+	return Uint128(a).Float64()
+}
+
+func (a Int128) neg() bool {
+	return int64(a.Hi) < 0
+}
+
+func (a Int128) abs() Uint128 {
+	if a.neg() {
+		return Uint128(a.Gop_Neg())
+	}
+	return Uint128(a)
+}
+
+func (a Int128) cmp(b Int128) int {
+	switch {
+	case int64(a.Hi) < int64(b.Hi):
+		return -1
+	case int64(a.Hi) > int64(b.Hi):
+		return 1
+	}
+	return Uint128{Lo: a.Lo}.cmp(Uint128{Lo: b.Lo})
+}
+
+func (a Int128) Gop_Add(b Int128) Int128 {
+	return Int128(Uint128(a).Gop_Add(Uint128(b)))
+}
+
+func (a Int128) Gop_Sub(b Int128) Int128 {
+	return Int128(Uint128(a).Gop_Sub(Uint128(b)))
+}
+
+func (a Int128) Gop_Mul(b Int128) Int128 {
+	return Int128(Uint128(a).Gop_Mul(Uint128(b)))
+}
+
+// Gop_Quo truncates toward zero, as C does.
+func (a Int128) Gop_Quo(b Int128) Int128 {
+	q := Int128(a.abs().Gop_Quo(b.abs()))
+	if a.neg() != b.neg() {
+		return q.Gop_Neg()
+	}
+	return q
+}
+
+// Gop_Rem has the sign of a, as C does.
+func (a Int128) Gop_Rem(b Int128) Int128 {
+	r := Int128(a.abs().Gop_Rem(b.abs()))
+	if a.neg() {
+		return r.Gop_Neg()
+	}
+	return r
+}
+
+func (a Int128) Gop_And(b Int128) Int128 {
+	return Int128{a.Lo & b.Lo, a.Hi & b.Hi}
+}
+
+func (a Int128) Gop_Or(b Int128) Int128 {
+	return Int128{a.Lo | b.Lo, a.Hi | b.Hi}
+}
+
+func (a Int128) Gop_Xor(b Int128) Int128 {
+	return Int128{a.Lo ^ b.Lo, a.Hi ^ b.Hi}
+}
+
+func (a Int128) Gop_Lsh(n uint) Int128 {
+	return Int128(Uint128(a).Gop_Lsh(n))
+}
+
+// Gop_Rsh is an arithmetic shift.
+func (a Int128) Gop_Rsh(n uint) Int128 {
+	if n >= 64 {
+		return Int128{uint64(int64(a.Hi) >> (n - 64)), uint64(int64(a.Hi) >> 63)}
+	}
+	return Int128{a.Lo>>n | a.Hi<<(64-n), uint64(int64(a.Hi) >> n)}
+}
+
+func (a Int128) Gop_LT(b Int128) bool { return a.cmp(b) < 0 }
+func (a Int128) Gop_LE(b Int128) bool { return a.cmp(b) <= 0 }
+func (a Int128) Gop_GT(b Int128) bool { return a.cmp(b) > 0 }
+func (a Int128) Gop_GE(b Int128) bool { return a.cmp(b) >= 0 }
+
+func (a Int128) Gop_Neg() Int128 { return Int128{}.Gop_Sub(a) }
+func (a Int128) Gop_Not() Int128 { return Int128{^a.Lo, ^a.Hi} }
+func (a Int128) Gop_Dup() Int128 { return a }
+
+func (a *Int128) Gop_AddAssign(b Int128) { *a = a.Gop_Add(b) }
+func (a *Int128) Gop_SubAssign(b Int128) { *a = a.Gop_Sub(b) }
+func (a *Int128) Gop_MulAssign(b Int128) { *a = a.Gop_Mul(b) }
+func (a *Int128) Gop_QuoAssign(b Int128) { *a = a.Gop_Quo(b) }
+func (a *Int128) Gop_RemAssign(b Int128) { *a = a.Gop_Rem(b) }
+func (a *Int128) Gop_AndAssign(b Int128) { *a = a.Gop_And(b) }
+func (a *Int128) Gop_OrAssign(b Int128)  { *a = a.Gop_Or(b) }
+func (a *Int128) Gop_XorAssign(b Int128) { *a = a.Gop_Xor(b) }
+func (a *Int128) Gop_LshAssign(n uint)   { *a = a.Gop_Lsh(n) }
+func (a *Int128) Gop_RshAssign(n uint)   { *a = a.Gop_Rsh(n) }
+
+func (a *Int128) Gop_Inc() { *a = a.Gop_Add(Int128{Lo: 1}) }
+func (a *Int128) Gop_Dec() { *a = a.Gop_Sub(Int128{Lo: 1}) }
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,121 @@
+package clang
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	two128 = new(big.Int).Lsh(big.NewInt(1), 128)
+	two127 = new(big.Int).Lsh(big.NewInt(1), 127)
+)
+
+func u128ToBig(a Uint128) *big.Int {
+	v := new(big.Int).SetUint64(a.Hi)
+	return v.Lsh(v, 64).Or(v, new(big.Int).SetUint64(a.Lo))
+}
+
+func i128ToBig(a Int128) *big.Int {
+	v := u128ToBig(Uint128(a))
+	if a.neg() {
+		v.Sub(v, two128)
+	}
+	return v
+}
+
+// wrap reduces v modulo 2^128, and makes it signed if signed is true.
+func wrap(v *big.Int, signed bool) *big.Int {
+	v = new(big.Int).Mod(v, two128)
+	if signed && v.Cmp(two127) >= 0 {
+		v.Sub(v, two128)
+	}
+	return v
+}
+
+func randU128(r *rand.Rand) Uint128 {
+	switch r.Intn(4) {
+	case 0:
+		return Uint128{Lo: r.Uint64()}
+	case 1:
+		return Uint128{Lo: uint64(r.Intn(100))}
+	}
+	return Uint128{Lo: r.Uint64(), Hi: r.Uint64() >> uint(r.Intn(64))}
+}
+
+func TestUint128(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		a, b := randU128(r), randU128(r)
+		x, y := u128ToBig(a), u128ToBig(b)
+		check := func(op string, got Uint128, want *big.Int) {
+			if u128ToBig(got).Cmp(wrap(want, false)) != 0 {
+				t.Fatalf("%v %s %v: got %v, want %v", x, op, y, u128ToBig(got), wrap(want, false))
+			}
+		}
+		check("+", a.Gop_Add(b), new(big.Int).Add(x, y))
+		check("-", a.Gop_Sub(b), new(big.Int).Sub(x, y))
+		check("*", a.Gop_Mul(b), new(big.Int).Mul(x, y))
+		if y.Sign() != 0 {
+			check("/", a.Gop_Quo(b), new(big.Int).Quo(x, y))
+			check("%", a.Gop_Rem(b), new(big.Int).Rem(x, y))
+		}
+		n := uint(r.Intn(128))
+		check("<<", a.Gop_Lsh(n), new(big.Int).Lsh(x, n))
+		check(">>", a.Gop_Rsh(n), new(big.Int).Rsh(x, n))
+		if a.Gop_LT(b) != (x.Cmp(y) < 0) || a.Gop_GE(b) != (x.Cmp(y) >= 0) {
+			t.Fatal("compare:", x, y)
+		}
+	}
+}
+
+func TestInt128(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 10000; i++ {
+		a, b := Int128(randU128(r)), Int128(randU128(r))
+		if r.Intn(2) == 0 {
+			a = a.Gop_Neg()
+		}
+		if r.Intn(2) == 0 {
+			b = b.Gop_Neg()
+		}
+		x, y := i128ToBig(a), i128ToBig(b)
+		check := func(op string, got Int128, want *big.Int) {
+			if i128ToBig(got).Cmp(wrap(want, true)) != 0 {
+				t.Fatalf("%v %s %v: got %v, want %v", x, op, y, i128ToBig(got), wrap(want, true))
+			}
+		}
+		check("+", a.Gop_Add(b), new(big.Int).Add(x, y))
+		check("-", a.Gop_Sub(b), new(big.Int).Sub(x, y))
+		check("*", a.Gop_Mul(b), new(big.Int).Mul(x, y))
+		if y.Sign() != 0 {
+			check("/", a.Gop_Quo(b), new(big.Int).Quo(x, y))
+			check("%", a.Gop_Rem(b), new(big.Int).Rem(x, y))
+		}
+		n := uint(r.Intn(128))
+		check("<<", a.Gop_Lsh(n), new(big.Int).Lsh(x, n))
+		check(">>", a.Gop_Rsh(n), new(big.Int).Rsh(x, n))
+		if a.Gop_LT(b) != (x.Cmp(y) < 0) || a.Gop_GE(b) != (x.Cmp(y) >= 0) {
+			t.Fatal("compare:", x, y)
+		}
+	}
+}
+
+func TestInt128Conv(t *testing.T) {
+	if v := Int128FromInt64(-5); v.Int64() != -5 || v.Float64() != -5 || i128ToBig(v).Int64() != -5 {
+		t.Fatal("Int128FromInt64:", v)
+	}
+	if v := Uint128FromInt64(-1); v.Lo != ^uint64(0) || v.Hi != ^uint64(0) {
+		t.Fatal("Uint128FromInt64:", v)
+	}
+	if v := Int128FromFloat64(-1e30); v.Float64() != -1e30 {
+		t.Fatal("Int128FromFloat64:", v.Float64())
+	}
+	if v := Uint128FromFloat64(3.9); v.Uint64() != 3 {
+		t.Fatal("Uint128FromFloat64:", v)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -73,8 +73,14 @@ func ParseFileEx(filename string, mode Mode, conf *Config) (file *ast.Node, warn
 	if conf != nil && conf.Json != nil {
 		*conf.Json = out
 	}
+	file, err = ParseJson(out)
+	return
+}
+
+// ParseJson parses AST of a C file dumped by DumpAST.
+func ParseJson(data []byte) (file *ast.Node, err error) {
 	file = new(ast.Node)
-	err = json.Unmarshal(out, file)
+	err = json.Unmarshal(data, file)
 	if err != nil {
 		err = &ParseError{Err: err}
 	}
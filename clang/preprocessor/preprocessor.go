@@ -29,6 +29,7 @@ type Config struct {
 	IncludeDirs []string
 	Defines     []string
 	Flags       []string
+	DepFile     string // if not empty, write included files to DepFile (see -MD)
 }
 
 func Do(infile, outfile string, conf *Config) (err error) {
@@ -43,11 +44,14 @@ func Do(infile, outfile string, conf *Config) (err error) {
 	if ppflag == "" {
 		ppflag = "-E"
 	}
-	n := 4 + len(conf.Flags) + len(conf.IncludeDirs) + len(conf.Defines)
+	n := 7 + len(conf.Flags) + len(conf.IncludeDirs) + len(conf.Defines)
 	args := make([]string, 3, n)
 	args[0] = ppflag
 	args[1], args[2] = "-o", outfile
 	args = append(args, conf.Flags...)
+	if conf.DepFile != "" {
+		args = append(args, "-MD", "-MF", conf.DepFile)
+	}
 	for _, def := range conf.Defines {
 		args = append(args, "-D"+def)
 	}
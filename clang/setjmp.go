@@ -0,0 +1,88 @@
+package clang
+
+import (
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+// A function which calls setjmp is translated into a loop of a closure, and
+// each setjmp call site of it is a resume point of the closure:
+//
+//	var _cgo_jf clang.JmpFrame
+//	for {
+//		_cgo_ret := func() int32 {
+//			defer _cgo_jf.Recover()
+//			if _cgo_jf.Resume() == 1 {
+//				goto _cgo_jmp_1
+//			}
+//			...
+//		_cgo_jmp_1:
+//			if _cgo_jf.Setjmp(unsafe.Pointer(&env[0]), 1) != 0 {
+//				...
+//			}
+//			...
+//		}()
+//		if _cgo_jf.Resume() == 0 {
+//			return _cgo_ret
+//		}
+//	}
+//
+// Longjmp panics with a jmpSignal, and JmpFrame.Recover of the function who
+// did the setjmp recovers it and resumes the closure at the setjmp point.
+
+type jmpSignal struct {
+	env unsafe.Pointer
+	val Int
+}
+
+// JmpFrame records setjmp points of a function call.
+type JmpFrame struct {
+	points map[unsafe.Pointer]int // env => setjmp point
+	point  int                    // setjmp point to resume
+	val    Int                    // value returned by setjmp when resuming
+}
+
+// Setjmp saves env as a jump target to the setjmp point and returns 0. When
+// the frame is resuming at the point, it returns the value passed to Longjmp.
+func (p *JmpFrame) Setjmp(env unsafe.Pointer, point int) Int {
+	if p.points == nil {
+		p.points = make(map[unsafe.Pointer]int)
+	}
+	p.points[env] = point
+	if p.point == point {
+		p.point = 0
+		return p.val
+	}
+	return 0
+}
+
+// Resume returns the setjmp point to resume, or 0 if there is no longjmp.
+func (p *JmpFrame) Resume() int {
+	return p.point
+}
+
+// Recover must be deferred. It recovers a longjmp to a setjmp point of the
+// frame, and repanics on any other panic.
+func (p *JmpFrame) Recover() {
+	if e := recover(); e != nil {
+		if sig, ok := e.(*jmpSignal); ok {
+			if point, ok := p.points[sig.env]; ok {
+				p.point, p.val = point, sig.val
+				return
+			}
+		}
+		panic(e)
+	}
+}
+
+// Longjmp jumps to the setjmp point saved in env, where setjmp returns val
+// (or 1 if val is 0).
+func Longjmp(env unsafe.Pointer, val Int) {
+	if val == 0 {
+		val = 1
+	}
+	panic(&jmpSignal{env: env, val: val})
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,72 @@
+package clang
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+type jmpBuf [8]Long
+
+func throw(env *jmpBuf, val Int) {
+	Longjmp(unsafe.Pointer(env), val)
+}
+
+// tryCall is the translation of:
+//
+//	int tryCall(jmp_buf env, int val) {
+//		int n = 0;
+//		if ((n = setjmp(env)) == 0) {
+//			throw(env, val);
+//		}
+//		return n;
+//	}
+func tryCall(env *jmpBuf, val Int) Int {
+	var n Int
+	var _cgo_jf JmpFrame
+	for {
+		_cgo_ret := func() Int {
+			defer _cgo_jf.Recover()
+			if _cgo_jf.Resume() == 1 {
+				goto _cgo_jmp_1
+			}
+			n = 0
+		_cgo_jmp_1:
+			if n = _cgo_jf.Setjmp(unsafe.Pointer(env), 1); n == 0 {
+				throw(env, val)
+			}
+			return n
+		}()
+		if _cgo_jf.Resume() == 0 {
+			return _cgo_ret
+		}
+	}
+}
+
+func TestSetjmp(t *testing.T) {
+	var env jmpBuf
+	if v := tryCall(&env, 3); v != 3 {
+		t.Fatal("tryCall(3):", v)
+	}
+	if v := tryCall(&env, 0); v != 1 {
+		t.Fatal("tryCall(0):", v)
+	}
+}
+
+func TestLongjmpUnknown(t *testing.T) {
+	defer func() {
+		if e := recover(); e == nil {
+			t.Fatal("longjmp to unknown env: no panic")
+		}
+	}()
+	var env, env2 jmpBuf
+	var jf JmpFrame
+	func() {
+		defer jf.Recover()
+		jf.Setjmp(unsafe.Pointer(&env), 1)
+		throw(&env2, 1)
+	}()
+}
+
+// -----------------------------------------------------------------------------
@@ -56,6 +56,9 @@ type Config struct {
 	TyAnonym  types.Type
 	TyInt128  types.Type
 	TyUint128 types.Type
+	TyLong    types.Type // long of the target, ctypes.Long if nil
+	TyUlong   types.Type // unsigned long of the target, ctypes.Ulong if nil
+	TyWchar   types.Type // wchar_t of the target, int32 if nil
 	Flags     int
 }
 
@@ -86,6 +89,8 @@ func ParseType(qualType string, conf *Config) (t types.Type, kind int, err error
 	}
 	if p.tok != token.EOF {
 		err = p.newError("unexpect token " + p.tok.String())
+	} else if p.vla {
+		t = lowerVLA(t)
 	}
 	return
 }
@@ -104,6 +109,7 @@ type parser struct {
 		tok token.Token
 		lit string
 	}
+	vla bool // has a variable length array
 }
 
 const (
@@ -180,9 +186,15 @@ func (p *parser) lookupType(tylit string, flags int) (t types.Type, err error) {
 	structOrUnion := (flags & flagStructOrUnion) != 0
 	_, o := gox.LookupParent(p.scope, tylit, token.NoPos)
 	if o == nil {
+		if t = p.charType(tylit); t != nil && !structOrUnion && flags == 0 {
+			return
+		}
 		return nil, &TypeNotFound{Literal: tylit, StructOrUnion: structOrUnion}
 	}
 	t = o.Type()
+	if _, ok := t.(*ctypes.VLA); ok { // typedef of VLA
+		p.vla = true
+	}
 	if !structOrUnion && flags != 0 {
 		tt, ok := t.(*types.Basic)
 		if !ok {
@@ -204,10 +216,10 @@ func (p *parser) lookupType(tylit string, flags int) (t types.Type, err error) {
 		} else {
 			switch tt.Kind() {
 			case types.Int:
-				if t = intTypes[flags&^flagSigned]; t != nil {
+				if t = p.intType(flags &^ flagSigned); t != nil {
 					return
 				}
-			case types.Int8:
+			case types.Int8, types.Uint8: // char is signed or unsigned
 				switch flags {
 				case flagUnsigned:
 					return types.Typ[types.Uint8], nil
@@ -230,6 +242,37 @@ func (p *parser) lookupType(tylit string, flags int) (t types.Type, err error) {
 	return
 }
 
+// charType returns the type of wchar_t, char16_t or char32_t if they aren't
+// defined by headers (they are keywords in C++, and typedefs in C).
+func (p *parser) charType(tylit string) types.Type {
+	switch tylit {
+	case "wchar_t":
+		if p.conf.TyWchar != nil {
+			return p.conf.TyWchar
+		}
+		return types.Typ[types.Int32]
+	case "char16_t":
+		return types.Typ[types.Uint16]
+	case "char32_t":
+		return types.Typ[types.Uint32]
+	}
+	return nil
+}
+
+func (p *parser) intType(flags int) types.Type {
+	switch flags {
+	case flagLong:
+		if p.conf.TyLong != nil {
+			return p.conf.TyLong
+		}
+	case flagLong | flagUnsigned:
+		if p.conf.TyUlong != nil {
+			return p.conf.TyUlong
+		}
+	}
+	return intTypes[flags]
+}
+
 var intTypes = [...]types.Type{
 	0:                                      ctypes.Int,
 	flagShort:                              types.Typ[types.Int16],
@@ -245,23 +288,22 @@ var intTypes = [...]types.Type{
 func (p *parser) parseArray(t types.Type, inFlags int) (types.Type, error) {
 	var n int64
 	var err error
-	p.next()
-	switch p.tok {
-	case token.RBRACK: // ]
+	if p.old.tok != invalidTok {
+		return nil, p.newError("unexpected " + p.old.tok.String())
+	}
+	expr := p.s.ScanArrayLen()
+	if err = p.expect(token.RBRACK); err != nil { // ]
+		return nil, err
+	}
+	if expr == "" {
 		if (inFlags & FlagIsField) != 0 {
 			n = 0
 		} else {
 			n = -1
 		}
-	case token.INT:
-		if n, err = strconv.ParseInt(p.lit, 10, 64); err != nil {
-			return nil, p.newError(err.Error())
-		}
-		if err = p.expect(token.RBRACK); err != nil { // ]
-			return nil, err
-		}
-	default:
-		return nil, p.newError("array length not an integer")
+	} else if n, err = strconv.ParseInt(expr, 10, 64); err != nil { // variable length array
+		p.vla = true
+		return ctypes.NewVLA(t, expr), nil
 	}
 	if n >= 0 || (inFlags&(FlagIsExtern|FlagIsTypedef|FlagIsParam)) != 0 {
 		t = types.NewArray(t, n)
@@ -539,23 +581,82 @@ func isPtr(tok token.Token) bool {
 }
 
 func newArrays(t types.Type, tyArr types.Type) types.Type {
-retry:
-	if arr, ok := tyArr.(*types.Array); ok {
-		t = types.NewArray(t, arr.Len())
-		tyArr = arr.Elem()
-		goto retry
+	for {
+		switch arr := tyArr.(type) {
+		case *types.Array:
+			if _, ok := t.(*ctypes.VLA); ok && arr.Len() >= 0 { // array of VLA is also a VLA
+				t = ctypes.NewVLA(t, strconv.FormatInt(arr.Len(), 10))
+			} else {
+				t = types.NewArray(t, arr.Len())
+			}
+			tyArr = arr.Elem()
+		case *ctypes.VLA:
+			t = ctypes.NewVLA(t, arr.Len)
+			tyArr = arr.Elem
+		default:
+			return t
+		}
 	}
-	return t
 }
 
 func newArraysEx(t types.Type, tyArr types.Type, inFlags int) types.Type {
 	t = newArrays(t, tyArr)
-	if arr, ok := t.(*types.Array); ok {
-		if (inFlags & FlagIsParam) != 0 {
+	if (inFlags & FlagIsParam) != 0 {
+		switch arr := t.(type) {
+		case *types.Array:
 			t = ctypes.NewPointer(arr.Elem())
+		case *ctypes.VLA:
+			t = ctypes.NewPointer(arr.Elem)
 		}
 	}
 	return t
 }
 
+// lowerVLA replaces pointers to VLA in t with pointers to their base element
+// types, eg. `int (*)[n]` => *int32. It keeps t itself if t is a VLA.
+func lowerVLA(t types.Type) types.Type {
+	switch v := t.(type) {
+	case *types.Pointer:
+		if vla, ok := v.Elem().(*ctypes.VLA); ok {
+			elem, _ := vla.Base()
+			return ctypes.NewPointer(lowerVLA(elem))
+		}
+		if elem := lowerVLA(v.Elem()); elem != v.Elem() {
+			return ctypes.NewPointer(elem)
+		}
+	case *types.Array:
+		if elem := lowerVLA(v.Elem()); elem != v.Elem() {
+			return types.NewArray(elem, v.Len())
+		}
+	case *ctypes.VLA:
+		if elem := lowerVLA(v.Elem); elem != v.Elem {
+			return ctypes.NewVLA(elem, v.Len)
+		}
+	case *types.Signature:
+		params, ok1 := lowerVLATuple(v.Params())
+		results, ok2 := lowerVLATuple(v.Results())
+		if ok1 || ok2 {
+			if gox.IsCSignature(v) {
+				return ctypes.NewFunc(params, results, v.Variadic())
+			}
+			return types.NewSignature(nil, params, results, v.Variadic())
+		}
+	}
+	return t
+}
+
+func lowerVLATuple(tuple *types.Tuple) (*types.Tuple, bool) {
+	n := tuple.Len()
+	vars := make([]*types.Var, n)
+	changed := false
+	for i := 0; i < n; i++ {
+		v := tuple.At(i)
+		if t := lowerVLA(v.Type()); t != v.Type() {
+			v, changed = types.NewParam(v.Pos(), v.Pkg(), v.Name(), t), true
+		}
+		vars[i] = v
+	}
+	return types.NewTuple(vars...), changed
+}
+
 // -----------------------------------------------------------------------------
@@ -157,6 +157,11 @@ var cases = []testCase{
 	{qualType: "int [100][3]", typ: tyInt3_100},
 	{qualType: "int (*)[100][3]", typ: tyPInt3_100},
 	{qualType: "int (*)[100]", typ: tyPInt100},
+	{qualType: "int (*)[n]", typ: types.NewPointer(tyInt)},
+	{qualType: "int (*)[n][3]", typ: types.NewPointer(tyInt3)},
+	{qualType: "int (*)[3][n]", typ: types.NewPointer(tyInt)},
+	{qualType: "int [n * 2]", flags: FlagIsParam, typ: types.NewPointer(tyInt)},
+	{qualType: "int [n][m]", flags: FlagIsParam, typ: types.NewPointer(tyInt)},
 	{qualType: "int (*const [2])(void *)", typ: types.NewArray(newFn(typesVoidPtr, typesInt), 2)},
 	{qualType: "char *", typ: tyCharPtr},
 	{qualType: "void", typ: ctypes.Void},
@@ -193,6 +198,51 @@ func TestCases(t *testing.T) {
 	}
 }
 
+func TestVLA(t *testing.T) {
+	cases := []struct {
+		qualType string
+		typ      string
+	}{
+		{"int [n]", "[n]int32"},
+		{"char [strlen(s) + 1]", "[strlen(s) + 1]int8"},
+		{"int [a[i]][3]", "[a[i]][3]int32"},
+		{"int [2][n][3]", "[2][n][3]int32"},
+	}
+	for _, c := range cases {
+		conf := &Config{Pkg: pkg, Scope: scope}
+		typ, _, err := ParseType(c.qualType, conf)
+		if err != nil {
+			t.Fatal("ParseType:", err)
+		}
+		if _, ok := typ.(*ctypes.VLA); !ok || typ.String() != c.typ {
+			t.Fatal("ParseType:", typ, ", expected:", c.typ)
+		}
+	}
+}
+
+func TestTargetTypes(t *testing.T) {
+	target, _ := ctypes.ParseTarget("armv7-linux-gnueabihf")
+	scope := types.NewScope(scope, token.NoPos, token.NoPos, "arm")
+	aliasType(scope, pkg, "char", target.Char())
+	conf := &Config{Pkg: pkg, Scope: scope, TyLong: target.Long(), TyUlong: target.Ulong(), TyWchar: target.Wchar()}
+	for _, c := range []testCase{
+		{qualType: "long", typ: tyInt32},
+		{qualType: "unsigned long", typ: tyUint32},
+		{qualType: "long long", typ: tyInt64},
+		{qualType: "char", typ: tyUchar},
+		{qualType: "signed char", typ: tyChar},
+		{qualType: "unsigned char", typ: tyUchar},
+		{qualType: "wchar_t", typ: tyUint32},
+		{qualType: "char16_t", typ: types.Typ[types.Uint16]},
+		{qualType: "const char32_t *", typ: types.NewPointer(tyUint32)},
+	} {
+		typ, _, err := ParseType(c.qualType, conf)
+		if err != nil || !ctypes.Identical(typ, c.typ) {
+			t.Fatal("ParseType:", c.qualType, typ, err)
+		}
+	}
+}
+
 func errMsgOf(err error) string {
 	if e, ok := err.(*ParseTypeError); ok {
 		return e.ErrMsg
@@ -3,6 +3,7 @@ package scanner
 import (
 	"fmt"
 	"go/token"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -239,6 +240,26 @@ func (s *Scanner) skipWhitespace() {
 	}
 }
 
+// ScanArrayLen scans the length expression of an array type from the current
+// position until the matching ']' (not included), eg. `n * 2` of `int [n * 2]`.
+func (s *Scanner) ScanArrayLen() string {
+	offs, depth := s.offset, 0
+	for ; s.ch != eof; s.next() {
+		switch s.ch {
+		case '[', '(':
+			depth++
+		case ')':
+			depth--
+		case ']':
+			if depth == 0 {
+				return strings.TrimSpace(s.src[offs:s.offset])
+			}
+			depth--
+		}
+	}
+	return strings.TrimSpace(s.src[offs:])
+}
+
 func (s *Scanner) Scan() (tok token.Token, lit string) {
 	s.skipWhitespace()
 
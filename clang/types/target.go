@@ -0,0 +1,176 @@
+package types
+
+import (
+	"errors"
+	"go/types"
+	"runtime"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+// Target describes the data model of the target which C files are compiled for.
+type Target struct {
+	Triple        string // target triple, eg. "x86_64-linux-gnu" (empty means the host)
+	PtrSize       int64  // size of pointers and size_t
+	LongSize      int64  // size of long
+	MaxAlign      int64  // max alignment of fields, eg. 4 if long long is 4 aligned
+	BiggestAlign  int64  // alignment of __attribute__((aligned)) without an argument
+	CharSigned    bool   // if char is signed
+	WcharSize     int64  // size of wchar_t
+	WcharUnsigned bool   // if wchar_t is unsigned
+}
+
+var (
+	ErrUnknownTarget = errors.New("unknown target")
+)
+
+// Host is the target which c2go runs on.
+var Host = hostTarget()
+
+func hostTarget() *Target {
+	arch, ok := goarchs[runtime.GOARCH]
+	if !ok {
+		arch = "x86_64"
+	}
+	t, err := parseTriple(arch + "-" + runtime.GOOS)
+	if err != nil {
+		panic(err)
+	}
+	t.Triple = ""
+	return t
+}
+
+// goarchs maps GOARCH to the arch of the host target. Note that wasm isn't in
+// it, since wasm of Go is 64 bits but wasm32 isn't. wasm32 is only chosen by
+// the target triple explicitly.
+var goarchs = map[string]string{
+	"amd64":    "x86_64",
+	"386":      "i386",
+	"arm64":    "aarch64",
+	"arm":      "arm",
+	"riscv64":  "riscv64",
+	"ppc64":    "powerpc64",
+	"ppc64le":  "powerpc64le",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+	"s390x":    "s390x",
+}
+
+// ParseTarget returns the data model of a target triple. Only the arch and os
+// parts of triple matter, eg. "aarch64-linux-gnu" and "aarch64-unknown-linux"
+// are the same.
+func ParseTarget(triple string) (*Target, error) {
+	if triple == "" {
+		return Host, nil
+	}
+	return parseTriple(triple)
+}
+
+func parseTriple(triple string) (*Target, error) {
+	parts := strings.Split(triple, "-")
+	t := &Target{Triple: triple, MaxAlign: 8, BiggestAlign: 16}
+	switch arch := parts[0]; arch {
+	case "x86_64", "amd64":
+		t.PtrSize, t.CharSigned = 8, true
+	case "i386", "i486", "i586", "i686", "x86":
+		t.PtrSize, t.MaxAlign, t.CharSigned = 4, 4, true
+	case "aarch64", "arm64":
+		t.PtrSize, t.WcharUnsigned = 8, true
+	case "arm", "armv6", "armv7", "armv7a", "armv7l", "thumbv7":
+		t.PtrSize, t.BiggestAlign, t.WcharUnsigned = 4, 8, true
+	case "wasm32":
+		t.PtrSize, t.CharSigned = 4, true
+	case "wasm64":
+		t.PtrSize, t.CharSigned = 8, true
+	case "riscv64", "powerpc64", "powerpc64le", "ppc64", "ppc64le", "s390x":
+		t.PtrSize = 8
+	case "riscv32", "powerpc", "ppc":
+		t.PtrSize = 4
+	case "mips", "mipsel":
+		t.PtrSize, t.BiggestAlign, t.CharSigned = 4, 8, true
+	case "mips64", "mips64el":
+		t.PtrSize, t.CharSigned = 8, true
+	default:
+		return nil, &TargetError{Triple: triple}
+	}
+	t.LongSize, t.WcharSize = t.PtrSize, 4
+	for _, part := range parts[1:] {
+		switch {
+		case strings.HasPrefix(part, "windows"), strings.HasPrefix(part, "win32"):
+			t.LongSize, t.CharSigned = 4, true // LLP64
+			t.WcharSize, t.WcharUnsigned = 2, true
+			if t.PtrSize == 4 {
+				t.MaxAlign = 8
+			}
+		case strings.HasPrefix(part, "darwin"), strings.HasPrefix(part, "macos"), strings.HasPrefix(part, "ios"):
+			t.CharSigned, t.WcharUnsigned = true, false
+		}
+	}
+	return t, nil
+}
+
+// TargetError is returned by ParseTarget if the arch of triple is unknown.
+type TargetError struct {
+	Triple string
+}
+
+func (p *TargetError) Error() string {
+	return "unknown target: " + p.Triple
+}
+
+func (p *TargetError) Unwrap() error {
+	return ErrUnknownTarget
+}
+
+// Flags returns clang flags to compile C files for this target.
+func (p *Target) Flags() []string {
+	if p.Triple == "" {
+		return nil
+	}
+	return []string{"--target=" + p.Triple}
+}
+
+// Long returns the Go type of long.
+func (p *Target) Long() types.Type {
+	if p.LongSize == 4 {
+		return types.Typ[types.Int32]
+	}
+	return types.Typ[types.Int64]
+}
+
+// Ulong returns the Go type of unsigned long.
+func (p *Target) Ulong() types.Type {
+	if p.LongSize == 4 {
+		return types.Typ[types.Uint32]
+	}
+	return types.Typ[types.Uint64]
+}
+
+// Char returns the Go type of char.
+func (p *Target) Char() types.Type {
+	if p.CharSigned {
+		return types.Typ[types.Int8]
+	}
+	return types.Typ[types.Uint8]
+}
+
+// Wchar returns the Go type of wchar_t.
+func (p *Target) Wchar() types.Type {
+	switch {
+	case p.WcharSize == 2:
+		return types.Typ[types.Uint16]
+	case p.WcharUnsigned:
+		return types.Typ[types.Uint32]
+	}
+	return types.Typ[types.Int32]
+}
+
+// Sizes returns sizes of Go types which C types are translated to.
+func (p *Target) Sizes() types.Sizes {
+	return &types.StdSizes{WordSize: p.PtrSize, MaxAlign: p.MaxAlign}
+}
+
+// -----------------------------------------------------------------------------
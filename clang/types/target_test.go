@@ -0,0 +1,49 @@
+package types
+
+import (
+	"errors"
+	"go/types"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestParseTarget(t *testing.T) {
+	cases := []struct {
+		triple     string
+		ptrSize    int64
+		longSize   int64
+		charSigned bool
+		wchar      types.Type
+	}{
+		{"x86_64-linux-gnu", 8, 8, true, types.Typ[types.Int32]},
+		{"i686-pc-linux-gnu", 4, 4, true, types.Typ[types.Int32]},
+		{"aarch64-linux-gnu", 8, 8, false, types.Typ[types.Uint32]},
+		{"arm64-apple-darwin", 8, 8, true, types.Typ[types.Int32]},
+		{"x86_64-w64-windows-gnu", 8, 4, true, types.Typ[types.Uint16]},
+		{"wasm32", 4, 4, true, types.Typ[types.Int32]},
+	}
+	for _, c := range cases {
+		target, err := ParseTarget(c.triple)
+		if err != nil {
+			t.Fatal("ParseTarget:", err)
+		}
+		if target.PtrSize != c.ptrSize || target.LongSize != c.longSize || target.CharSigned != c.charSigned {
+			t.Fatal("ParseTarget:", c.triple, *target)
+		}
+		if target.Wchar() != c.wchar {
+			t.Fatal("Wchar:", c.triple, target.Wchar())
+		}
+		if flags := target.Flags(); len(flags) != 1 || flags[0] != "--target="+c.triple {
+			t.Fatal("Flags:", flags)
+		}
+	}
+	if target, err := ParseTarget(""); err != nil || target != Host || target.Flags() != nil {
+		t.Fatal("ParseTarget host:", target, err)
+	}
+	if _, err := ParseTarget("pdp11-unix"); !errors.Is(err, ErrUnknownTarget) {
+		t.Fatal("ParseTarget pdp11:", err)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -3,7 +3,6 @@ package types
 import (
 	"go/token"
 	"go/types"
-	"unsafe"
 
 	"github.com/goplus/gox"
 )
@@ -16,8 +15,8 @@ var (
 
 	Int     = types.Typ[types.Int32]
 	Uint    = types.Typ[types.Uint32]
-	Long    = types.Typ[uintptr(types.Int32)+unsafe.Sizeof(0)>>3]  // int32/int64
-	Ulong   = types.Typ[uintptr(types.Uint32)+unsafe.Sizeof(0)>>3] // uint32/uint64
+	Long    = Host.Long()  // int32/int64
+	Ulong   = Host.Ulong() // uint32/uint64
 	NotImpl = UnsafePointer
 
 	LongDouble = types.Typ[types.Float64]
@@ -46,6 +45,41 @@ func init() {
 
 // -----------------------------------------------------------------------------
 
+// VLA represents a variable length array type T[N], whose length N is a C
+// expression evaluated at runtime. A VLA object is translated into a pointer
+// to its first element, and so is a pointer to VLA.
+type VLA struct {
+	Elem types.Type // T, which may also be a VLA
+	Len  string     // N, eg. `n * 2`
+}
+
+func NewVLA(elem types.Type, len string) *VLA {
+	return &VLA{Elem: elem, Len: len}
+}
+
+func (p *VLA) Underlying() types.Type {
+	return p
+}
+
+func (p *VLA) String() string {
+	return "[" + p.Len + "]" + p.Elem.String()
+}
+
+// Base returns the element type of a VLA which isn't a VLA, and lengths of
+// the dimensions, eg. [3]int32 and [2, n] for `int [2][n][3]`.
+func (p *VLA) Base() (elem types.Type, lens []string) {
+	var t types.Type = p
+	for {
+		vla, ok := t.(*VLA)
+		if !ok {
+			return t, lens
+		}
+		t, lens = vla.Elem, append(lens, vla.Len)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
 func NewFunc(params, results *types.Tuple, variadic bool) *types.Signature {
 	return gox.NewCSignature(params, results, variadic)
 }
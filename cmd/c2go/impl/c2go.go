@@ -11,7 +11,7 @@ import (
 )
 
 const (
-	ShortUsage = "c2go [-test -testmain -ff -pp -json -sel selectfile -gendeps -v] [pkgname] source\n"
+	ShortUsage = "c2go [-test -testmain -ff -pp -json -sel selectfile -gendeps -layouttest -v] [pkgname] source\n"
 )
 
 func isDir(name string) bool {
@@ -25,12 +25,18 @@ func Main(flag *flag.FlagSet, args []string) {
 	var (
 		verbose    = flag.Bool("v", false, "print verbose information")
 		failfast   = flag.Bool("ff", false, "fail fast (stop if an error is encountered)")
-		preprocess = flag.Bool("pp", false, "force to run preprocessor")
+		preprocess = flag.Bool("pp", false, "force to run preprocessor (ignore the build cache, see $C2GO_CACHE)")
 		gendeps    = flag.Bool("gendeps", false, "generate dependencies automatically")
 		json       = flag.Bool("json", false, "dump C AST to a file in json format")
 		test       = flag.Bool("test", false, "run test")
 		testmain   = flag.Bool("testmain", false, "generate TestMain as entry instead of main (only for cmd/test_xxx)")
+		keepgoing  = flag.Bool("k", false, "keep going: stub out functions which can't be translated")
+		neutral    = flag.Bool("neutral", false, "generate architecture-neutral Go code (clang.Long, unsafe.Sizeof, etc.)")
+		layouttest = flag.Bool("layouttest", false, "generate c2go_layout_test.go to check layouts of structs and unions against clang")
 		sel        = flag.String("sel", "", "select a file (only available in project mode)")
+		jobs       = flag.Int("j", 1, "number of packages (or files of a project) to process in parallel")
+		outDir     = flag.String("o", "", "put intermediate and generated files in this directory, mirroring the source tree")
+		target     = flag.String("target", "", "target triple to translate for, eg. i386-linux-gnu (default: the host)")
 	)
 	flag.Parse(args)
 	var pkgname, infile string
@@ -68,9 +74,18 @@ func Main(flag *flag.FlagSet, args []string) {
 	if *json {
 		flags |= c2go.FlagDumpJson
 	}
+	if *keepgoing {
+		flags |= c2go.FlagKeepGoing
+	}
+	if *neutral {
+		flags |= c2go.FlagArchNeutral
+	}
+	if *layouttest {
+		flags |= c2go.FlagLayoutTest
+	}
 	var conf *c2go.Config
-	if *sel != "" {
-		conf = &c2go.Config{Select: *sel}
+	if *sel != "" || *jobs > 1 || *outDir != "" || *target != "" {
+		conf = &c2go.Config{Select: *sel, Jobs: *jobs, OutDir: *outDir, Triple: *target}
 	}
 	c2go.Run(pkgname, infile, flags, conf)
 }
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2022 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package c2go
+
+import (
+	"bytes"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+// goCommand returns a command which runs `go subcmd args...` in root of the Go
+// module where srcDir is. If Go files are generated in out dirs, they are put
+// back into their source directories by -overlay, so that packages are built
+// with hand-written Go files next to C files, and by go.mod of the module.
+// Paths in args should be absolute. Call done after the command finishes.
+func (p *output) goCommand(srcDir, subcmd string, args ...string) (cmd *exec.Cmd, done func()) {
+	done = func() {}
+	cmdArgs := []string{subcmd}
+	if overlay := p.writeOverlay(); overlay != "" {
+		cmdArgs = append(cmdArgs, "-overlay", overlay)
+		done = func() { os.Remove(overlay) }
+	}
+	cmd = exec.CommandContext(p.ctx, "go", append(cmdArgs, args...)...)
+	cmd.Dir = modRoot(srcDir)
+	return
+}
+
+// goImporter returns an importer which imports Go packages by goCommand, so
+// that Go packages generated in out dirs (eg. dependent packages of a project)
+// can be imported. It returns nil if there isn't any out dir.
+func (p *output) goImporter(fset *token.FileSet, srcDir string) types.Importer {
+	if len(p.res.allMirrors()) == 0 {
+		return nil
+	}
+	return importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		var stdout, stderr bytes.Buffer
+		cmd, done := p.goCommand(srcDir, "list", "-export", "-f", "{{.Export}}", path)
+		defer done()
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("go list %s: %v\n%s", path, err, stderr.Bytes())
+		}
+		return os.Open(strings.TrimSpace(stdout.String()))
+	})
+}
+
+type goOverlay struct {
+	Replace map[string]string
+}
+
+// writeOverlay writes a file for `go build -overlay` which maps source paths of
+// Go files generated in out dirs to where they are, and returns its path. It
+// returns "" if there isn't any.
+func (p *output) writeOverlay() string {
+	replace := make(map[string]string)
+	for outDir, srcRoot := range p.res.allMirrors() {
+		filepath.Walk(outDir, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() && strings.HasSuffix(path, ".go") {
+				replace[srcPath(srcRoot, outDir, path)] = path
+			}
+			return nil
+		})
+	}
+	if len(replace) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(&goOverlay{Replace: replace})
+	check(err)
+	f, err := os.CreateTemp("", "c2go-overlay-*.json")
+	check(err)
+	_, err = f.Write(b)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	check(err)
+	return f.Name()
+}
+
+// modRoot returns root directory of the Go module where dir is, or dir itself
+// if it isn't in any module.
+func modRoot(dir string) string {
+	absDir, err := filepath.Abs(dir)
+	check(err)
+	for root := absDir; ; {
+		if isFile(filepath.Join(root, "go.mod")) {
+			return root
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return absDir
+		}
+		root = parent
+	}
+}
+
+// -----------------------------------------------------------------------------
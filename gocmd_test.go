@@ -0,0 +1,79 @@
+package c2go
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, data := range files {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunGoAppOutDir(t *testing.T) {
+	root, outDir := t.TempDir(), t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"go.mod":      "module example.com/app\n\ngo 1.16\n",
+		"app/libc.go": "package main\n\nfunc hello() string { return \"hello\" }\n",
+	})
+	writeTestFiles(t, outDir, map[string]string{
+		"app/app.c.i.go": "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(hello()) }\n",
+	})
+	var stdout, stderr bytes.Buffer
+	out := newOutput(context.Background(), &stdout, &stderr, OSTarget).mirror(root, outDir)
+	srcDir, goDir := filepath.Join(root, "app"), filepath.Join(outDir, "app")
+	runGoApp(srcDir, goDir, &stdout, &stderr, false, out)
+	if stdout.String() != "hello\n" {
+		t.Fatalf("runGoApp: %q, stderr: %s", stdout.String(), stderr.String())
+	}
+	if isFile(filepath.Join(goDir, goOut)) || isFile(filepath.Join(srcDir, goOut)) {
+		t.Fatal("runGoApp: executable isn't removed")
+	}
+}
+
+func TestWriteOverlay(t *testing.T) {
+	root, outDir := t.TempDir(), t.TempDir()
+	writeTestFiles(t, outDir, map[string]string{
+		"foo/foo.go":     "package foo\n",
+		"foo/foo.c.i":    "",
+		"__/bar/bar.go":  "package bar\n",
+		"c2go.overlay.x": "",
+	})
+	out := newOutput(context.Background(), nil, nil, OSTarget).mirror(filepath.Join(root, "prj"), outDir)
+	overlay := out.writeOverlay()
+	defer os.Remove(overlay)
+	b, err := os.ReadFile(overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret goOverlay
+	if err = json.Unmarshal(b, &ret); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		filepath.Join(root, "prj", "foo", "foo.go"): filepath.Join(outDir, "foo", "foo.go"),
+		filepath.Join(root, "bar", "bar.go"):        filepath.Join(outDir, "__", "bar", "bar.go"),
+	}
+	if len(ret.Replace) != len(want) {
+		t.Fatal("writeOverlay:", ret.Replace)
+	}
+	for src, file := range want {
+		if ret.Replace[src] != file {
+			t.Fatal("writeOverlay:", src, ret.Replace[src])
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2022 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package c2go
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/weblfe/c2go/cl"
+	"github.com/weblfe/c2go/clang/preprocessor"
+	ctypes "github.com/weblfe/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// output is where a job prints and writes to.
+type output struct {
+	ctx    context.Context
+	stdout io.Writer
+	stderr io.Writer
+	target Target
+	res    *buildResult   // shared by all jobs
+	arch   *ctypes.Target // target which C files are compiled for
+
+	srcRoot string // root of the source tree which outDir mirrors
+	outDir  string // where to put intermediate and generated files
+}
+
+// buildResult collects generated Go files and diagnostics of all jobs.
+type buildResult struct {
+	mutex   sync.Mutex
+	files   map[string][]byte
+	diags   cl.ErrorList
+	mirrors map[string]string     // outDir => srcRoot of all mirrors, see goCommand
+	deps    map[string]*sync.Once // dependent packages of this build, see procDepOnce
+}
+
+func newOutput(ctx context.Context, stdout, stderr io.Writer, target Target) *output {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	res := &buildResult{
+		files:   make(map[string][]byte),
+		mirrors: make(map[string]string),
+		deps:    make(map[string]*sync.Once),
+	}
+	return &output{ctx: ctx, stdout: stdout, stderr: stderr, target: target, res: res, arch: ctypes.Host}
+}
+
+// mirror returns an output which puts files generated for srcRoot in outDir,
+// mirroring layout of srcRoot. If outDir is empty, files are put next to their
+// source files.
+func (p *output) mirror(srcRoot, outDir string) *output {
+	if outDir == p.outDir && srcRoot == p.srcRoot {
+		return p
+	}
+	ret := *p
+	ret.srcRoot, ret.outDir = srcRoot, outDir
+	if outDir != "" {
+		p.res.addMirror(srcRoot, outDir)
+	}
+	return &ret
+}
+
+// outPath returns where to put a file which is generated for the source file
+// (or directory) path, and creates its parent directory. A path outside
+// srcRoot is put in outDir as if its ".." elements are "__".
+func (p *output) outPath(path string) string {
+	if p.outDir == "" {
+		return path
+	}
+	if _, ok := relPath(p.outDir, path); ok { // already in outDir
+		return path
+	}
+	rel, _ := relPath(p.srcRoot, path)
+	elems := strings.Split(rel, string(filepath.Separator))
+	for i, elem := range elems {
+		if elem == ".." {
+			elems[i] = "__"
+		}
+	}
+	ret := filepath.Join(p.outDir, filepath.Join(elems...))
+	err := os.MkdirAll(filepath.Dir(ret), 0777)
+	check(err)
+	return ret
+}
+
+// srcPath is the inverse of outPath: it returns the source path which a file
+// (or directory) path in outDir is generated for.
+func srcPath(srcRoot, outDir, path string) string {
+	rel, _ := relPath(outDir, path)
+	elems := strings.Split(rel, string(filepath.Separator))
+	for i := 0; i < len(elems) && elems[i] == "__"; i++ {
+		elems[i] = ".."
+	}
+	return filepath.Join(srcRoot, filepath.Join(elems...))
+}
+
+// relPath returns path relative to root, and reports whether path is in root.
+func relPath(root, path string) (string, bool) {
+	absRoot, err := filepath.Abs(root)
+	check(err)
+	absPath, err := filepath.Abs(path)
+	check(err)
+	rel, err := filepath.Rel(absRoot, absPath)
+	check(err)
+	return rel, rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ppConfig returns how to preprocess C files which aren't in a c2go project.
+func (p *output) ppConfig() *preprocessor.Config {
+	return &preprocessor.Config{Flags: p.arch.Flags()}
+}
+
+// checkCanceled stops the job if the build is canceled.
+func (p *output) checkCanceled() {
+	check(p.ctx.Err())
+}
+
+// writeFile writes a generated Go file to the target.
+func (p *output) writeFile(name string, data []byte) {
+	err := p.target.WriteFile(name, data)
+	check(err)
+	p.res.mutex.Lock()
+	p.res.files[name] = data
+	p.res.mutex.Unlock()
+}
+
+// writeFileBy writes a generated Go file whose content is generated by write.
+func (p *output) writeFileBy(name string, write func(w io.Writer) error) []byte {
+	var b bytes.Buffer
+	err := write(&b)
+	check(err)
+	p.writeFile(name, b.Bytes())
+	return b.Bytes()
+}
+
+func (p *output) addDiags(diags cl.ErrorList) {
+	p.res.mutex.Lock()
+	p.res.diags = append(p.res.diags, diags...)
+	p.res.mutex.Unlock()
+}
+
+func (p *buildResult) addMirror(srcRoot, outDir string) {
+	absRoot, err := filepath.Abs(srcRoot)
+	check(err)
+	absOut, err := filepath.Abs(outDir)
+	check(err)
+	p.mutex.Lock()
+	p.mirrors[absOut] = absRoot
+	p.mutex.Unlock()
+}
+
+// allMirrors returns a copy of mirrors, keyed by outDir.
+func (p *buildResult) allMirrors() map[string]string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := make(map[string]string, len(p.mirrors))
+	for outDir, srcRoot := range p.mirrors {
+		ret[outDir] = srcRoot
+	}
+	return ret
+}
+
+// jobBuffer buffers output of a job. Unlike bytes.Buffer it doesn't have a
+// Bytes method, so fatalWith won't take it as captured output of a command.
+type jobBuffer struct {
+	buf bytes.Buffer
+}
+
+func (p *jobBuffer) Write(b []byte) (int, error) {
+	return p.buf.Write(b)
+}
+
+type jobResult struct {
+	stdout jobBuffer
+	stderr jobBuffer
+	err    error
+	panic  interface{}
+	done   chan struct{}
+}
+
+// parallel runs job(0), ..., job(n-1) with at most `jobs` of them at the same
+// time. Outputs of jobs are flushed to out in order of jobs, and so are panics:
+// if a job panics, parallel panics after flushing outputs of this job and all
+// jobs before it. It returns the last error of jobs.
+func parallel(n, jobs int, out *output, job func(i int, out *output) error) (last error) {
+	if jobs <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			out.checkCanceled()
+			if e := job(i, out); e != nil {
+				last = e
+			}
+		}
+		return
+	}
+	rets := make([]*jobResult, n)
+	for i := range rets {
+		rets[i] = &jobResult{done: make(chan struct{})}
+	}
+	var failed int32
+	go func() {
+		sem := make(chan struct{}, jobs)
+		for i, ret := range rets {
+			sem <- struct{}{}
+			if atomic.LoadInt32(&failed) != 0 { // don't start new jobs
+				close(ret.done)
+				<-sem
+				continue
+			}
+			go func(i int, ret *jobResult) {
+				defer func() {
+					if e := recover(); e != nil {
+						ret.panic = e
+						atomic.StoreInt32(&failed, 1)
+					}
+					close(ret.done)
+					<-sem
+				}()
+				jobOut := *out
+				jobOut.stdout, jobOut.stderr = &ret.stdout, &ret.stderr
+				jobOut.checkCanceled()
+				ret.err = job(i, &jobOut)
+			}(i, ret)
+		}
+	}()
+	for _, ret := range rets {
+		<-ret.done
+		out.stdout.Write(ret.stdout.buf.Bytes())
+		out.stderr.Write(ret.stderr.buf.Bytes())
+		if ret.panic != nil {
+			panic(ret.panic)
+		}
+		if ret.err != nil {
+			last = ret.err
+		}
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// procDepOnce calls doProc to process the dependent package in pkgDir, only
+// once in a build even if many jobs depend on it at the same time.
+func (p *output) procDepOnce(pkgDir string, doProc func()) {
+	p.res.mutex.Lock()
+	once, ok := p.res.deps[pkgDir]
+	if !ok {
+		once = new(sync.Once)
+		p.res.deps[pkgDir] = once
+	}
+	p.res.mutex.Unlock()
+	once.Do(doProc)
+}
+
+// -----------------------------------------------------------------------------
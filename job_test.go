@@ -0,0 +1,60 @@
+package c2go
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestOutPath(t *testing.T) {
+	root, outDir := t.TempDir(), t.TempDir()
+	srcRoot := filepath.Join(root, "prj")
+	out := newOutput(context.Background(), nil, nil, InMemory)
+	if ret := out.outPath(filepath.Join(srcRoot, "foo.c.i")); ret != filepath.Join(srcRoot, "foo.c.i") {
+		t.Fatal("outPath without outDir:", ret)
+	}
+	out = out.mirror(srcRoot, outDir)
+	for _, c := range []struct {
+		path, want string
+	}{
+		{filepath.Join(srcRoot, "foo.c.i"), filepath.Join(outDir, "foo.c.i")},
+		{filepath.Join(srcRoot, "a", "b", "bar.c.i"), filepath.Join(outDir, "a", "b", "bar.c.i")},
+		{filepath.Join(root, "libc", "c2go.a.pub"), filepath.Join(outDir, "__", "libc", "c2go.a.pub")},
+		{filepath.Join(outDir, "a", "x.go"), filepath.Join(outDir, "a", "x.go")}, // already in outDir
+		{srcRoot, outDir},
+	} {
+		ret := out.outPath(c.path)
+		if ret != c.want {
+			t.Fatal("outPath:", c.path, ret)
+		}
+		if !isDir(filepath.Dir(ret)) {
+			t.Fatal("outPath: directory isn't created -", ret)
+		}
+		if ret != c.path {
+			if src := srcPath(srcRoot, outDir, ret); src != c.path {
+				t.Fatal("srcPath:", ret, src)
+			}
+		}
+	}
+	if mirrors := out.res.allMirrors(); len(mirrors) != 1 || mirrors[outDir] != srcRoot {
+		t.Fatal("allMirrors:", mirrors)
+	}
+}
+
+func TestProcDepOnce(t *testing.T) {
+	var n int
+	for i := 0; i < 2; i++ { // each build processes the dependent package again
+		out := newOutput(context.Background(), nil, nil, InMemory)
+		parallel(4, 4, out, func(i int, out *output) error {
+			out.procDepOnce("libc", func() { n++ })
+			return nil
+		})
+		if n != i+1 {
+			t.Fatal("procDepOnce:", i, n)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
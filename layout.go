@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2022 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package c2go
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/weblfe/c2go/cl"
+	"github.com/weblfe/c2go/clang/ast"
+	"github.com/weblfe/c2go/clang/parser"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	layoutTestFile = "c2go_layout_test.go"
+	layoutProbe    = "_cgo_layout_"
+)
+
+// writeLayoutTest writes c2go_layout_test.go into dir, which checks layouts of
+// records of pkg against clang, if FlagLayoutTest is set.
+func writeLayoutTest(pkg cl.Package, dir string, gofiles map[string][]byte, flags int, out *output) {
+	if (flags & FlagLayoutTest) == 0 {
+		return
+	}
+	recs := pkg.Records()
+	if len(recs) == 0 {
+		return
+	}
+	probeLayouts(recs, out)
+	gofiles[layoutTestFile] = out.writeFileBy(filepath.Join(dir, layoutTestFile), pkg.WriteLayoutTestTo)
+}
+
+// probeLayouts sets layouts of records in C, which are got from clang. For
+// each source file of records, a probe file is made by appending typedefs like
+// this to it:
+//
+//	typedef char _cgo_layout_0[sizeof(struct foo) + 1];
+//	typedef char _cgo_layout_1[_Alignof(struct foo) + 1];
+//	typedef char _cgo_layout_2[__builtin_offsetof(struct foo, x) + 1];
+//
+// and layouts are read from types of these typedefs in its AST (one more byte
+// is added to avoid arrays of zero length).
+func probeLayouts(recs []*cl.Record, out *output) {
+	var srcFiles []string
+	files := make(map[string][]*cl.Record)
+	for _, r := range recs {
+		if _, ok := files[r.SrcFile]; !ok {
+			srcFiles = append(srcFiles, r.SrcFile)
+		}
+		files[r.SrcFile] = append(files[r.SrcFile], r)
+	}
+	for _, srcFile := range srcFiles {
+		out.checkCanceled()
+		probeFileLayouts(srcFile, files[srcFile], out)
+	}
+}
+
+func probeFileLayouts(srcFile string, recs []*cl.Record, out *output) {
+	src, err := os.ReadFile(srcFile)
+	check(err)
+	b := bytes.NewBuffer(src)
+	var vals []*int64
+	probe := func(expr string, val *int64) {
+		fmt.Fprintf(b, "\ntypedef char %s%d[%s + 1];", layoutProbe, len(vals), expr)
+		vals = append(vals, val)
+	}
+	for _, r := range recs {
+		probe("sizeof("+r.CType+")", &r.Size)
+		probe("_Alignof("+r.CType+")", &r.Align)
+		for _, f := range r.Fields {
+			probe("__builtin_offsetof("+r.CType+", "+f.CName+")", &f.Offset)
+		}
+	}
+	b.WriteByte('\n')
+
+	probeFile := strings.TrimSuffix(srcFile, ".i") + ".layout.i"
+	check(os.WriteFile(probeFile, b.Bytes(), 0666))
+	defer os.Remove(probeFile)
+	doc, _, err := parser.ParseFileEx(probeFile, 0, &parser.Config{Flags: out.arch.Flags()})
+	check(err)
+	n := 0
+	for _, decl := range doc.Inner {
+		if decl.Kind != ast.TypedefDecl || !strings.HasPrefix(decl.Name, layoutProbe) {
+			continue
+		}
+		i, err := strconv.Atoi(decl.Name[len(layoutProbe):])
+		check(err)
+		*vals[i] = arrayLen(decl.Type.QualType) - 1
+		n++
+	}
+	if n != len(vals) {
+		fatalf("probeLayouts: %d of %d layouts are got from %s\n", n, len(vals), probeFile)
+	}
+}
+
+// arrayLen returns N of an array type "T [N]".
+func arrayLen(qualType string) int64 {
+	pos := strings.LastIndexByte(qualType, '[')
+	n, err := strconv.ParseInt(strings.TrimSuffix(qualType[pos+1:], "]"), 10, 64)
+	check(err)
+	return n
+}
+
+// -----------------------------------------------------------------------------
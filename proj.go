@@ -18,15 +18,15 @@ package c2go
 
 import (
 		"fmt"
+		"go/token"
 		"os"
 		"os/exec"
 		"path/filepath"
 		"strings"
 
-		"github.com/goplus/gox"
 		"github.com/goplus/gox/cpackages"
 		"github.com/weblfe/c2go/cl"
-		"github.com/weblfe/c2go/clang/parser"
+		"github.com/weblfe/c2go/clang/ast"
 		"github.com/weblfe/c2go/clang/preprocessor"
 
 		jsoniter "github.com/json-iterator/go"
@@ -68,17 +68,19 @@ type c2goConf struct {
 		Flags    []string   `json:"flags"`
 		PPFlag   string     `json:"pp"` // default: -E
 		Compiler string     `json:"cc"`
+		OutDir   string     `json:"outDir"` // relative to the project directory
 
 		cl.Reused `json:"-"`
 
 		dir         string            `json:"-"`
 		public      map[string]string `json:"-"`
 		needPkgInfo bool              `json:"-"`
+		jobs        int               `json:"-"`
 }
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
-func execProj(projfile string, flags int, in *Config) {
+func execProj(projfile string, flags int, in *Config, out *output) {
 		b, err := os.ReadFile(projfile)
 		check(err)
 
@@ -89,6 +91,10 @@ func execProj(projfile string, flags int, in *Config) {
 		base, _ := filepath.Split(projfile)
 		conf.needPkgInfo = (flags & FlagDepsAutoGen) != 0
 		conf.dir = base
+		conf.jobs = in.jobs()
+		if out.outDir == "" && conf.OutDir != "" { // -o overrides outDir of projects
+				out = out.mirror(base, canonical(base, conf.OutDir))
+		}
 		noSource := len(conf.Source.Dirs) == 0 && len(conf.Source.Files) == 0
 		if noSource {
 				if len(conf.Target.Cmds) == 0 {
@@ -106,18 +112,19 @@ func execProj(projfile string, flags int, in *Config) {
 				check(err)
 
 				if in != nil && in.Select != "" {
-						execProjFile(canonical(base, in.Select), &conf, appFlags)
+						execProjFile(canonical(base, in.Select), &conf, appFlags, out)
 						return
 				}
-				execProjSource(base, appFlags, &conf)
+				execProjSource(base, appFlags, &conf, out)
 
-				err = cpackages.WritePubFile(base+"c2go.a.pub", conf.public)
+				err = cpackages.WritePubFile(out.outPath(base+"c2go.a.pub"), conf.public)
 				check(err)
 		}
 		if cmds := conf.Target.Cmds; len(cmds) != 0 {
 				conf.Target.Cmds = nil
 				conf.public = nil
 				for _, cmd := range cmds {
+						out.checkCanceled()
 						conf.Target.Name = "main"
 						appFlags := flags
 						if (flags & FlagTestMain) != 0 {
@@ -135,17 +142,17 @@ func execProj(projfile string, flags int, in *Config) {
 										appFlags &= ^FlagRunTest
 								}
 						}
-						fmt.Printf("==> Building %s ...\n", cmd.Dir)
+						fmt.Fprintf(out.stdout, "==> Building %s ...\n", cmd.Dir)
 						conf.Source = cmd.Source
 						conf.Deps = cmd.Deps
 						conf.Target.Dir = cmd.Dir
-						execProjSource(base, appFlags, &conf)
+						execProjSource(base, appFlags, &conf, out)
 						if (appFlags & FlagRunTest) != 0 {
-								cmd2 := exec.Command(clangOut)
-								cmd2.Dir = canonical(base, cmd.Dir)
-								cmd2.Stdout = os.Stdout
-								cmd2.Stderr = os.Stderr
-								fmt.Printf("==> Running %s ...\n", cmd2.Dir)
+								cmd2 := exec.CommandContext(out.ctx, clangOut)
+								cmd2.Dir = out.outPath(canonical(base, cmd.Dir))
+								cmd2.Stdout = out.stdout
+								cmd2.Stderr = out.stderr
+								fmt.Fprintf(out.stdout, "==> Running %s ...\n", cmd2.Dir)
 								check(cmd2.Run())
 								os.Remove(filepath.Join(cmd2.Dir, clangOut))
 						}
@@ -153,55 +160,52 @@ func execProj(projfile string, flags int, in *Config) {
 		}
 }
 
-func execProjSource(base string, flags int, conf *c2goConf) {
+func execProjSource(base string, flags int, conf *c2goConf, out *output) {
 		conf.Reused = cl.Reused{}
+		var files []string
 		for _, dir := range conf.Source.Dirs {
 				recursively := strings.HasSuffix(dir, "/...")
 				if recursively {
 						dir = dir[:len(dir)-4]
 				}
-				execProjDir(canonical(base, dir), conf, flags, recursively)
+				files = collectProjDir(files, canonical(base, dir), recursively)
 		}
 		for _, file := range conf.Source.Files {
-				execProjFile(canonical(base, file), conf, flags)
+				files = append(files, canonical(base, file))
 		}
-		execProjDone(base, flags, conf)
+		execProjFiles(files, conf, flags, out)
+		execProjDone(base, flags, conf, out)
 }
 
-func execProjDone(base string, flags int, conf *c2goConf) {
+func execProjDone(base string, flags int, conf *c2goConf, out *output) {
 		if pkg := conf.Reused.Pkg(); pkg.IsValid() {
-				dir := canonical(base, conf.Target.Dir)
-				os.MkdirAll(dir, 0777)
-				pkg.ForEachFile(func(fname string, file *gox.File) {
-						gofile := fname
-						if strings.HasPrefix(fname, "_") {
-								gofile = "x2g" + fname
-						}
-						err := pkg.WriteFile(filepath.Join(dir, gofile), fname)
-						check(err)
-				})
-				if conf.needPkgInfo {
-						err := pkg.WriteDepFile(filepath.Join(dir, "c2go_autogen.go"))
-						check(err)
+				srcDir, err := filepath.Abs(canonical(base, conf.Target.Dir))
+				check(err)
+				dir := out.outPath(srcDir)
+				gofiles := writePkgFiles(pkg, dir, conf.needPkgInfo, out)
+				writeLayoutTest(pkg, dir, gofiles, flags, out)
+				if out.target != OSTarget { // Go files aren't written to dir
+						return
 				}
 				var cmd *exec.Cmd
+				var done func()
 				if (flags&FlagRunTest) != 0 && conf.Target.Name == "main" {
-						cmd = exec.Command("go", "build", "-o", clangOut, ".")
+						cmd, done = out.goCommand(srcDir, "build", "-o", filepath.Join(dir, clangOut), srcDir)
 				} else {
-						cmd = exec.Command("go", "install", ".")
+						cmd, done = out.goCommand(srcDir, "install", srcDir)
 				}
-				cmd.Dir = dir
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
+				defer done()
+				cmd.Stdout = out.stdout
+				cmd.Stderr = out.stderr
 				check(cmd.Run())
 		} else {
 				fatalf("empty project: no *.c files in this directory.\n")
 		}
 }
 
-func execProjDir(dir string, conf *c2goConf, flags int, recursively bool) {
+func collectProjDir(files []string, dir string, recursively bool) []string {
 		if strings.HasPrefix(dir, "_") {
-				return
+				return files
 		}
 		fis, err := os.ReadDir(dir)
 		check(err)
@@ -210,65 +214,118 @@ func execProjDir(dir string, conf *c2goConf, flags int, recursively bool) {
 				if fi.IsDir() {
 						if recursively {
 								pkgDir := filepath.Join(dir, fname)
-								execProjDir(pkgDir, conf, flags, true)
+								files = collectProjDir(files, pkgDir, true)
 						}
 						continue
 				}
 				if strings.HasSuffix(fi.Name(), ".c") {
-						pkgFile := filepath.Join(dir, fname)
-						execProjFile(pkgFile, conf, flags)
+						files = append(files, filepath.Join(dir, fname))
 				}
 		}
+		return files
 }
 
-func execProjFile(infile string, conf *c2goConf, flags int) {
-		fmt.Printf("==> Compiling %s ...\n", infile)
-
-		outfile := infile + ".i"
-		if (flags&FlagForcePreprocess) != 0 || !isFile(outfile) {
-				err := preprocessor.Do(infile, outfile, &preprocessor.Config{
-						BaseDir:     conf.dir,
-						IncludeDirs: conf.Include,
-						Defines:     conf.Define,
-						Flags:       conf.Flags,
-						PPFlag:      conf.PPFlag,
-						Compiler:    conf.Compiler,
-				})
-				check(err)
+// execProjFiles preprocesses and parses C files in parallel, and then compiles
+// them one by one because they share the same Go package instance.
+func execProjFiles(files []string, conf *c2goConf, flags int, out *output) {
+		tus := make([]transUnit, len(files))
+		docs := make([]*ast.Node, len(files))
+		parallel(len(files), conf.jobs, out, func(i int, out *output) error {
+				tus[i], docs[i] = parseProjFile(files[i], conf, flags, out)
+				return nil
+		})
+		for i, infile := range files {
+				compileProjFile(infile, tus[i], docs[i], conf, flags, out)
 		}
+}
 
-		var json []byte
-		doc, _, err := parser.ParseFileEx(outfile, 0, &parser.Config{
-				Json:   &json,
-				Flags:  conf.Flags,
-				Stderr: true,
-		})
-		check(err)
+func execProjFile(infile string, conf *c2goConf, flags int, out *output) {
+		tu, doc := parseProjFile(infile, conf, flags, out)
+		compileProjFile(infile, tu, doc, conf, flags, out)
+}
 
-		if (flags & FlagDumpJson) != 0 {
-				os.WriteFile(infile+".json", json, 0666)
-		}
+// parseProjFile preprocesses infile and dumps its AST. Results are reused
+// from the build cache if infile and all headers it includes don't change.
+// Note that Go files of a project are always regenerated, because they also
+// depend on the project config and dependent packages.
+func parseProjFile(infile string, conf *c2goConf, flags int, out *output) (transUnit, *ast.Node) {
+		outfile := out.outPath(infile + ".i")
+		ccflags := append(out.arch.Flags(), conf.Flags...)
+		tu := theCache.preprocess(infile, outfile, &preprocessor.Config{
+				BaseDir:     conf.dir,
+				IncludeDirs: conf.Include,
+				Defines:     conf.Define,
+				Flags:       ccflags,
+				PPFlag:      conf.PPFlag,
+				Compiler:    conf.Compiler,
+		}, ccflags, (flags&FlagForcePreprocess) != 0)
+
+		dumpJson(tu, flags, out)
+		return tu, tu.doc()
+}
+
+func compileProjFile(infile string, tu transUnit, doc *ast.Node, conf *c2goConf, flags int, out *output) {
+		out.checkCanceled()
+		fmt.Fprintf(out.stdout, "==> Compiling %s ...\n", infile)
 
 		procDepPkg := func(pkgDir string) {
-				headerFile := pkgDir + "/c2go_header.i.go"
-				if !isFile(headerFile) {
-						Run("", pkgDir, flags, nil)
-				}
+				out.procDepOnce(pkgDir, func() {
+						headerFile := filepath.Join(depOutDir(pkgDir, out), "c2go_header.i.go")
+						if !isFile(headerFile) {
+								execDepPkg(pkgDir, flags, out)
+						}
+				})
 		}
-		_, err = cl.NewPackage("", conf.Target.Name, doc, &cl.Config{
-				SrcFile:     outfile,
+		fset := token.NewFileSet()
+		_, err := cl.NewPackage("", conf.Target.Name, doc, &cl.Config{
+				Fset:        fset,
+				Importer:    out.goImporter(fset, conf.dir),
+				SrcFile:     tu.file,
 				ProcDepPkg:  procDepPkg,
+				DepOutDir:   func(pkgDir string) string { return depOutDir(pkgDir, out) },
 				Public:      conf.public,
 				PublicFrom:  conf.Public.From,
 				NeedPkgInfo: conf.needPkgInfo,
+				NeedRecords: (flags & FlagLayoutTest) != 0,
 				Dir:         conf.dir,
 				Deps:        conf.Deps,
 				Include:     conf.Include,
 				Ignored:     conf.Source.Ignore.Names,
 				Reused:      &conf.Reused,
 				TestMain:    (flags & FlagTestMain) != 0,
+				KeepGoing:   (flags & FlagKeepGoing) != 0,
+				Target:      out.arch,
+				ArchNeutral: (flags & FlagArchNeutral) != 0,
 		})
+		out.checkDiags(err)
+}
+
+// execDepPkg translates the dependent package in pkgDir. Unlike run, it puts
+// generated files where out puts files of pkgDir (see depOutDir).
+func execDepPkg(pkgDir string, flags int, out *output) {
+		projfile := filepath.Join(pkgDir, "c2go.cfg")
+		if isFile(projfile) {
+				execProj(projfile, flags, nil, out)
+				return
+		}
+		n, err := execDir("", pkgDir, flags, out)
 		check(err)
+		if n == 0 {
+				fatalf("no *.c files in this directory.\n")
+		}
+}
+
+// depOutDir returns where generated files (c2go.a.pub, c2go_header.i.go, etc.)
+// of the dependent package in pkgDir are.
+func depOutDir(pkgDir string, out *output) string {
+		if out.outDir == "" {
+				var conf c2goConf
+				if b, err := os.ReadFile(filepath.Join(pkgDir, "c2go.cfg")); err == nil && json.Unmarshal(b, &conf) == nil && conf.OutDir != "" {
+						return canonical(pkgDir, conf.OutDir)
+				}
+				return pkgDir
+		}
+		return out.outPath(pkgDir)
 }
 
 func canonical(baseDir string, uri string) string {
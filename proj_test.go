@@ -0,0 +1,68 @@
+package c2go
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestProjOutDir(t *testing.T) {
+	if _, err := exec.LookPath("clang"); err != nil {
+		t.Skip("clang not found")
+	}
+	outDir, gobin := t.TempDir(), t.TempDir()
+	old := os.Getenv("GOBIN")
+	os.Setenv("GOBIN", gobin)
+	defer os.Setenv("GOBIN", old)
+
+	_, err := Build(context.Background(), Options{Input: "./testdata/helloprj", OutDir: outDir, ForcePreprocess: true})
+	if err != nil {
+		t.Fatal("Build:", err)
+	}
+	for _, file := range []string{
+		"cmd/hello/c2go_header.i.go",
+		"__/libc/c2go.a.pub", // dependent package is put in outDir too
+		"__/libc/c2go_header.i.go",
+	} {
+		if !isFile(filepath.Join(outDir, file)) {
+			t.Fatal("not found:", file)
+		}
+	}
+	if isDir("./testdata/helloprj/cmd") {
+		t.Fatal("generated files are put in the source tree")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(gobin, "hello*")); len(matches) == 0 {
+		t.Fatal("hello isn't installed")
+	}
+}
+
+// TestProjOutDirs builds a project twice in one process, so its dependent
+// package must be processed again for the second out dir.
+func TestProjOutDirs(t *testing.T) {
+	if _, err := exec.LookPath("clang"); err != nil {
+		t.Skip("clang not found")
+	}
+	gobin := t.TempDir()
+	old := os.Getenv("GOBIN")
+	os.Setenv("GOBIN", gobin)
+	defer os.Setenv("GOBIN", old)
+
+	for i := 0; i < 2; i++ {
+		outDir := t.TempDir()
+		_, err := Build(context.Background(), Options{Input: "./testdata/helloprj", OutDir: outDir})
+		if err != nil {
+			t.Fatal("Build:", i, err)
+		}
+		for _, file := range []string{"__/libc/c2go.a.pub", "__/libc/c2go_header.i.go"} {
+			if !isFile(filepath.Join(outDir, file)) {
+				t.Fatal("not found:", i, file)
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
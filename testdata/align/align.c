@@ -0,0 +1,33 @@
+#include <stdio.h>
+#include <stddef.h>
+
+struct vec {
+    char tag;
+    _Alignas(16) float v[4];
+    int n __attribute__((aligned(8)));
+};
+
+struct __attribute__((aligned(32))) line {
+    char c;
+    short s;
+};
+
+union cell {
+    char c[5];
+    int i;
+};
+
+static _Alignas(64) char cache[100];
+
+int main() {
+    _Alignas(32) int x = 7;
+    struct line lines[2] = {{'a', 1}, {'b', 2}};
+    struct vec v = {'v', {1, 2, 3, 4}, 5};
+    printf("alignof: %d %d %d %d\n", (int)_Alignof(struct vec), (int)_Alignof(struct line),
+           (int)_Alignof(union cell), (int)__alignof__(double));
+    printf("sizeof: %d %d %d\n", (int)sizeof(struct vec), (int)sizeof(lines), (int)sizeof(union cell));
+    printf("offsetof: %d %d\n", (int)offsetof(struct vec, v), (int)offsetof(struct vec, n));
+    printf("aligned: %d %d %d\n", (int)((size_t)&x % 32), (int)((size_t)lines % 32), (int)((size_t)cache % 64));
+    printf("values: %d %c %d %c %d\n", x, lines[1].c, lines[1].s, v.tag, v.n);
+    return 0;
+}
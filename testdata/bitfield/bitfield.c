@@ -20,6 +20,34 @@ typedef struct {
     int :8*(sizeof(time_t)-sizeof(long))*(1234!=4321);
 } timespec_t;
 
+typedef struct {
+    unsigned int flags :3,
+        mode :4;
+    int delta :5;
+} bar;
+
+void testOpAssign() {
+    bar b = {5, 9, -3};
+    bar *p = &b;
+    int v;
+    printf("b.flags = %d, b.mode = %d, b.delta = %d\n", b.flags, b.mode, b.delta);
+    b.flags |= 2;
+    b.mode &= 3;
+    b.delta += 7;
+    p->mode <<= 2;
+    printf("b.flags = %d, b.mode = %d, b.delta = %d\n", b.flags, b.mode, b.delta);
+    b.flags++;
+    ++p->mode;
+    b.delta--;
+    v = --b.delta;
+    printf("b.flags = %d, b.mode = %d, b.delta = %d, v = %d\n", b.flags, b.mode, b.delta, v);
+    b.delta = 15;
+    v = b.delta++;
+    printf("b.delta = %d, v = %d\n", b.delta, v);
+    v = (b.mode += 5);
+    printf("b.mode = %d, v = %d\n", b.mode, v);
+}
+
 int main() {
     foo foo;
     foo.a = 1;
@@ -34,5 +62,6 @@ int main() {
     printf(
         "foo.x = %d, foo.y = %d, foo.z = %d\n",
         foo.x, foo.y, foo.z);
+    testOpAssign();
     return 0;
 }
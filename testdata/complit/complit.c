@@ -0,0 +1,32 @@
+#include <stdio.h>
+
+struct point {
+    int x, y;
+};
+
+int* primes = (int[]){2, 3, 5, 7};
+struct point* origin = &(struct point){0, 0};
+
+int sum(int* a, int n) {
+    int s = 0;
+    for (int i = 0; i < n; i++) {
+        s += a[i];
+    }
+    return s;
+}
+
+int dist(struct point p) {
+    return p.x + p.y;
+}
+
+int main() {
+    int(*pa)[3] = &(int[]){1, 2, 3};
+    int* pi = &(int){42};
+    struct point p;
+    p = (struct point){.y = 4, .x = 3};
+    printf("sum = %d, primes = %d\n", sum((int[]){1, 2, 3, 4}, 4), sum(primes, 4));
+    printf("(*pa)[2] = %d, *pi = %d\n", (*pa)[2], *pi);
+    printf("p = (%d, %d), dist = %d\n", p.x, p.y, dist((struct point){1, 2}));
+    printf("origin = (%d, %d)\n", origin->x, origin->y);
+    return 0;
+}
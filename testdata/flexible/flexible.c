@@ -0,0 +1,34 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <stddef.h>
+
+struct buf {
+    int len;
+    char tag;
+    int data[];
+};
+
+int sum(struct buf *p) {
+    int i, n = 0;
+    for (i = 0; i < p->len; i++) {
+        n += p->data[i];
+    }
+    return n;
+}
+
+int main() {
+    int i, n = 5;
+    struct buf *p = malloc(sizeof(*p) + n * sizeof(int));
+    int *q;
+    p->len = n;
+    p->tag = 'b';
+    for (i = 0; i < n; i++) {
+        p->data[i] = i * i;
+    }
+    q = p->data;
+    q[0] = 100;
+    printf("sizeof: %d, offsetof: %d\n", (int)sizeof(struct buf), (int)offsetof(struct buf, data));
+    printf("tag: %c, sum: %d\n", p->tag, sum(p));
+    free(p);
+    return 0;
+}
@@ -44,6 +44,31 @@ void h() {
     }
 }
 
+void k(int n) {
+    int i = 1, sum = 0;
+    goto half;
+    for (i = 0; i < n; i++) {
+        if (i % 2) {
+            continue;
+        }
+half:
+        sum += i;
+        printf("k: i = %d, sum = %d\n", i, sum);
+    }
+}
+
+void duff(int count) {
+    int n = (count + 3) / 4, sum = 0;
+    switch (count % 4) {
+    case 0: for (; n > 0; n--) { sum++;
+    case 3:     sum++;
+    case 2:     sum++;
+    case 1:     sum++;
+            }
+    }
+    printf("duff(%d) = %d\n", count, sum);
+}
+
 int main() {
     int a = sizeof(int);
     int *b = &a;
@@ -80,5 +105,9 @@ done:
     f(-1);
     g(2);
     h();
+    k(5);
+    duff(0);
+    duff(5);
+    duff(11);
     return 0;
 }
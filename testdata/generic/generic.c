@@ -0,0 +1,20 @@
+#include <stdio.h>
+
+static int absi(int x) { return x < 0 ? -x : x; }
+static float absf(float x) { return x < 0 ? -x : x; }
+static double absd(double x) { return x < 0 ? -x : x; }
+
+#define ABS(x) _Generic((x), float: absf, double: absd, default: absi)(x)
+#define TYPENAME(x) _Generic((x), int: "int", float: "float", double: "double", default: "other")
+
+int main() {
+    int i = -3;
+    float f = -1.5f;
+    double d = -2.25;
+    char c = 'c';
+    printf("%d %.2f %.2f\n", ABS(i), ABS(f), ABS(d));
+    printf("%s %s %s %s\n", TYPENAME(i), TYPENAME(f), TYPENAME(d), TYPENAME(c));
+    _Generic(d, double: d, default: f) = 4.5;
+    printf("%.2f\n", d);
+    return 0;
+}
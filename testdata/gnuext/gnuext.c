@@ -0,0 +1,50 @@
+#include <stdio.h>
+
+#define max(a, b) ({ int _a = (a), _b = (b); _a > _b ? _a : _b; })
+
+static int calls = 0;
+
+int next() {
+    return ++calls;
+}
+
+const char* kind(char c) {
+    switch (c) {
+    case '0' ... '9':
+        return "digit";
+    case 'a' ... 'z':
+    case 'A' ... 'Z':
+        return "letter";
+    case ' ':
+        return "space";
+    }
+    return "other";
+}
+
+int grade(int score) {
+    int ret = 0;
+    switch (score / 10) {
+        ret = -1;
+    case 9 ... 10:
+        ret++;
+    case 6 ... 8:
+        ret++;
+        break;
+    default:
+        ret = -2;
+    }
+    return ret;
+}
+
+int main() {
+    int i, n = max(next(), 3);
+    int a[8] = {[1 ... 3] = 7, [5 ... 6] = 4 * 2};
+    ({ n += 10; });
+    printf("max = %d, calls = %d\n", max(next(), n), calls);
+    for (i = 0; i < 8; i++) {
+        printf("a[%d] = %d\n", i, a[i]);
+    }
+    printf("%s %s %s %s %s\n", kind('7'), kind('q'), kind('Q'), kind(' '), kind('#'));
+    printf("%d %d %d\n", grade(95), grade(70), grade(30));
+    return 0;
+}
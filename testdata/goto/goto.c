@@ -0,0 +1,48 @@
+#include <stdio.h>
+
+enum { OP_PUSH, OP_ADD, OP_MUL, OP_PRINT, OP_HALT };
+
+int run(const int* code) {
+    static void* dispatch[] = {&&op_push, &&op_add, &&op_mul, &&op_print, &&op_halt};
+    int stack[16], sp = 0, n = 0;
+    const int* pc = code;
+
+#define NEXT() goto *dispatch[*pc++]
+    NEXT();
+op_push:
+    stack[sp++] = *pc++;
+    NEXT();
+op_add:
+    sp--;
+    stack[sp - 1] += stack[sp];
+    NEXT();
+op_mul:
+    sp--;
+    stack[sp - 1] *= stack[sp];
+    NEXT();
+op_print:
+    printf("%d\n", stack[sp - 1]);
+    n++;
+    NEXT();
+op_halt:
+    return n;
+}
+
+int count(int n) {
+    void* next = &&loop;
+    int i = 0;
+loop:
+    if (++i >= n) {
+        next = &&done;
+    }
+    goto *next;
+done:
+    return i;
+}
+
+int main() {
+    int code[] = {OP_PUSH, 2, OP_PUSH, 3, OP_ADD, OP_PRINT, OP_PUSH, 7, OP_MUL, OP_PRINT, OP_HALT};
+    printf("run = %d\n", run(code));
+    printf("count = %d\n", count(5));
+    return 0;
+}
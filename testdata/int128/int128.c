@@ -0,0 +1,23 @@
+#include <stdio.h>
+
+typedef unsigned __int128 u128;
+
+static u128 mulmod(u128 a, u128 b, u128 m) {
+    return (a * b) % m;
+}
+
+int main() {
+    u128 x = (u128)0xFFFFFFFFFFFFFFFFULL * 0x100000001ULL;
+    __int128 y = -(__int128)12345678901234567LL;
+    unsigned long long hi = (unsigned long long)(x >> 64);
+    unsigned long long lo = (unsigned long long)x;
+    printf("hi = %llu, lo = %llu\n", hi, lo);
+    printf("y / 7 = %lld, y %% 7 = %lld\n", (long long)(y / 7), (long long)(y % 7));
+    y <<= 70;
+    y >>= 68;
+    printf("y = %lld, neg = %d\n", (long long)y, y < 0);
+    x += 1;
+    x++;
+    printf("mulmod = %llu, x & 0xff = %llu\n", (unsigned long long)mulmod(x, x, 1000000007), (unsigned long long)(x & 0xff));
+    return 0;
+}
@@ -0,0 +1,16 @@
+#include <stdio.h>
+
+int main(int argc, char *argv[], char *envp[]) {
+    int n = 0, nenv = 0;
+    while (argv[n]) {
+        n++;
+    }
+    while (envp[nenv]) {
+        nenv++;
+    }
+    printf("argc > 0: %d\n", argc > 0);
+    printf("argv[argc] == NULL: %d\n", n == argc);
+    printf("argv[0] != \"\": %d\n", argv[0][0] != '\0');
+    printf("envp: %d\n", nenv >= 0);
+    return 0;
+}
@@ -0,0 +1,15 @@
+#include "calc.h"
+
+static int twice(int a) {
+    return a + a;
+}
+
+int add(int a, int b) {
+    return a + b;
+}
+
+point move(point p, int dx, int dy) {
+    p.x = add(p.x, twice(dx));
+    p.y = add(p.y, twice(dy));
+    return p;
+}
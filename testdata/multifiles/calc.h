@@ -0,0 +1,11 @@
+#ifndef CALC_H
+#define CALC_H
+
+typedef struct {
+    int x, y;
+} point;
+
+int add(int a, int b);
+point move(point p, int dx, int dy);
+
+#endif
@@ -0,0 +1,14 @@
+#include <stdio.h>
+#include "calc.h"
+
+static int twice(int a) {
+    return 2 * a;
+}
+
+int main() {
+    point p = {1, 2};
+    p = move(p, 3, 4);
+    printf("%d %d %d\n", add(1, 2), p.x, p.y);
+    printf("%d\n", twice(5));
+    return 0;
+}
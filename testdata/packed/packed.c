@@ -0,0 +1,37 @@
+#include <stdio.h>
+#include <stddef.h>
+
+struct __attribute__((packed)) header {
+    char tag;
+    int len;
+    short kind;
+};
+
+#pragma pack(push, 2)
+struct record {
+    char c;
+    int x;
+    double d;
+};
+#pragma pack(pop)
+
+struct entry {
+    char c;
+    int x __attribute__((packed));
+    short s;
+};
+
+int main() {
+    struct header h = {'h', 1000, 7};
+    struct record r = {'r', 42, 1.5};
+    struct entry e = {'e', 9, 3};
+    h.len += 24;
+    r.x *= 2;
+    printf("sizeof: %d %d %d\n", (int)sizeof(struct header), (int)sizeof(struct record), (int)sizeof(struct entry));
+    printf("offsetof: %d %d %d %d\n", (int)offsetof(struct header, len), (int)offsetof(struct header, kind),
+           (int)offsetof(struct record, x), (int)offsetof(struct record, d));
+    printf("header: %c %d %d\n", h.tag, h.len, h.kind);
+    printf("record: %c %d %.1f\n", r.c, r.x, r.d);
+    printf("entry: %c %d %d %d\n", e.c, e.x, e.s, (int)offsetof(struct entry, s));
+    return 0;
+}
@@ -0,0 +1,37 @@
+#include <stdio.h>
+#include <setjmp.h>
+
+static jmp_buf env;
+
+void fail(int code) {
+    printf("fail(%d)\n", code);
+    longjmp(env, code);
+}
+
+int try(int code) {
+    volatile int tries = 0;
+    int r = setjmp(env);
+    tries++;
+    if (r != 0) {
+        printf("caught %d after %d tries\n", r, tries);
+        return r;
+    }
+    if (code >= 0) {
+        fail(code);
+    }
+    return -1;
+}
+
+int main() {
+    jmp_buf local;
+    volatile int i = 0;
+    printf("try(3) = %d\n", try(3));
+    printf("try(0) = %d\n", try(0));
+    printf("try(-1) = %d\n", try(-1));
+    if (setjmp(local) < 3) {
+        i++;
+        longjmp(local, i);
+    }
+    printf("i = %d\n", i);
+    return 0;
+}
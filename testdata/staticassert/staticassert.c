@@ -0,0 +1,24 @@
+#include <stdio.h>
+#include <stddef.h>
+
+struct point {
+    short x;
+    int y;
+    char tag;
+};
+
+enum { MAX_POINTS = 4 };
+
+_Static_assert(sizeof(struct point) == 12, "sizeof(struct point)");
+_Static_assert(offsetof(struct point, y) == 4, "offsetof(struct point, y)");
+_Static_assert(offsetof(struct point, tag) == 8, "offsetof(struct point, tag)");
+_Static_assert(_Alignof(struct point) == 4, "_Alignof(struct point)");
+
+int main() {
+    struct point pts[MAX_POINTS];
+    _Static_assert(sizeof(pts) == MAX_POINTS * sizeof(struct point), "sizeof(pts)");
+    pts[0].x = 1;
+    pts[0].y = 2;
+    printf("%d %d %d\n", (int)sizeof(pts), pts[0].x, pts[0].y);
+    return 0;
+}
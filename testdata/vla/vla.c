@@ -0,0 +1,43 @@
+#include <stdio.h>
+
+int sum(int n, int m, int a[n][m]) {
+    int i, j, s = 0;
+    for (i = 0; i < n; i++) {
+        for (j = 0; j < m; j++) {
+            s += a[i][j];
+        }
+    }
+    return s;
+}
+
+void fill(int n, char* buf) {
+    int i;
+    for (i = 0; i < n; i++) {
+        buf[i] = 'a' + i;
+    }
+    buf[n] = '\0';
+}
+
+int main() {
+    int i, j, n = 3, m = 4;
+    char buf[n * 2 + 1];
+    int a[n][m];
+    int (*row)[m] = a;
+    for (i = 0; i < n; i++) {
+        for (j = 0; j < m; j++) {
+            a[i][j] = i * m + j;
+        }
+    }
+    fill(n * 2, buf);
+    printf("buf = %s, sizeof(buf) = %d\n", buf, (int)sizeof(buf));
+    printf("sizeof(a) = %d, sizeof(a[0]) = %d\n", (int)sizeof(a), (int)sizeof(a[0]));
+    printf("sizeof(int[n]) = %d\n", (int)sizeof(int[n]));
+    printf("row[2][1] = %d, sum = %d\n", row[2][1], sum(n, m, a));
+    int (*q)[m] = row + 2;
+    row++;
+    row += 1;
+    --row;
+    printf("(*(row+1))[3] = %d, q-row = %d, *(1+row) == a[2]: %d\n",
+        (*(row + 1))[3], (int)(q - row), *(1 + row) == a[2]);
+    return 0;
+}
@@ -0,0 +1,24 @@
+#include <stdio.h>
+#include <stddef.h>
+
+wchar_t hello[] = L"héllo";
+
+int wlen(const wchar_t* s) {
+    int n = 0;
+    while (s[n]) {
+        n++;
+    }
+    return n;
+}
+
+int main() {
+    unsigned short u16[] = u"a\U0001F600";
+    unsigned int u32[] = U"a\U0001F600";
+    char u8[] = u8"é";
+    wchar_t c = L'é';
+    printf("wlen = %d, hello[1] = %d\n", wlen(hello), (int)hello[1]);
+    printf("u16 = %d, %d, %d\n", (int)(sizeof(u16) / sizeof(u16[0])), (int)u16[1], (int)u16[2]);
+    printf("u32 = %d, %d\n", (int)(sizeof(u32) / sizeof(u32[0])), (int)u32[1]);
+    printf("u8 = %d, c = %d, U = %d\n", (int)sizeof(u8), (int)c, (int)U'\U0001F600');
+    return 0;
+}